@@ -2,15 +2,19 @@ package census_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
+	"os"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
 	"github.com/vocdoni/davinci-onchain-census/go-tool/census"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
 )
 
-// Example demonstrates how to reconstruct the census tree from subgraph events
+// Example demonstrates how to reconstruct the census tree from subgraph events.
+// It needs a live subgraph endpoint, so it is compiled but not executed.
 func Example_reconstructTree() {
 	ctx := context.Background()
 
@@ -21,8 +25,8 @@ func Example_reconstructTree() {
 	// Step 2: Create adapter
 	adapter := census.NewSubgraphAdapter(client)
 
-	// Step 3: Create tree reconstructor
-	reconstructor := census.NewTreeReconstructor(adapter)
+	// Step 3: Create tree reconstructor (silent by default, print progress to stdout)
+	reconstructor := census.NewTreeReconstructor(adapter, census.WithProgress(census.PrettyProgress(os.Stdout)))
 
 	// Step 4: Reconstruct tree
 	tree, root, size, err := reconstructor.ReconstructTree(ctx)
@@ -42,23 +46,47 @@ func Example_reconstructTree() {
 	//     return
 	// }
 
-	// Step 6: Generate proofs for specific addresses
+	// Step 6: Generate a contract-ready proof for a specific address
 	address := common.HexToAddress("0xdeb8699659be5d41a0e57e179d6cb42e00b9200c")
-	weight := uint64(3)
-	leaf := census.PackLeaf(address, weight)
+	proof, err := census.ProofFor(tree, address)
+	if errors.Is(err, census.ErrNotInTree) {
+		fmt.Printf("  %s has no weight, no proof needed\n", address.Hex())
+		return
+	}
+	if err != nil {
+		fmt.Printf("Failed to generate proof: %v\n", err)
+		return
+	}
+	fmt.Printf("  Proof for %s (weight %s): %d siblings\n",
+		proof.Account.Hex(), proof.CurrentWeight, len(proof.Siblings))
+}
 
-	index := tree.IndexOf(leaf)
-	if index != -1 {
-		proof, err := tree.GenerateProof(index)
-		if err != nil {
-			fmt.Printf("Failed to generate proof: %v\n", err)
-			return
-		}
-		fmt.Printf("  Proof for %s: %d siblings\n", address.Hex(), len(proof.Siblings))
+// Example demonstrates reconstructing the tree offline, from a fake subgraph serving fixed events
+func Example_fakeSubgraph() {
+	alice := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{
+		WeightChangeEvents: []subgraphtest.WeightChange{
+			{Account: alice, PreviousWeight: 0, NewWeight: 2, BlockNumber: 10, LogIndex: 0},
+			{Account: bob, PreviousWeight: 0, NewWeight: 1, BlockNumber: 10, LogIndex: 1},
+			{Account: bob, PreviousWeight: 1, NewWeight: 0, BlockNumber: 12, LogIndex: 0},
+		},
+	})
+	defer server.Close()
+
+	reconstructor := census.NewTreeReconstructor(census.NewSubgraphAdapter(server.Client()))
+	_, _, size, err := reconstructor.ReconstructTree(context.Background())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
 	}
 
+	_, weight, _ := reconstructor.AccountIndex().Lookup(alice)
+	fmt.Printf("Size: %d, alice weight: %d, block: %d\n", size, weight, reconstructor.Block().Number)
+
 	// Output:
-	// ✓ Tree reconstructed successfully
+	// Size: 2, alice weight: 2, block: 12
 }
 
 // Example demonstrates using a custom subgraph client implementation
@@ -74,7 +102,7 @@ func Example_customClient() {
 	reconstructor := census.NewTreeReconstructor(customClient)
 
 	// Reconstruct tree
-	tree, root, size, err := reconstructor.ReconstructTree(ctx)
+	_, root, size, err := reconstructor.ReconstructTree(ctx)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
@@ -114,10 +142,14 @@ func Example_leafOperations() {
 	}
 
 	// Output:
+	// Packed leaf: 0x1234567890123456789012345678901234567890000000000000000000002a
+	// Address: 0x1234567890123456789012345678901234567890
+	// Weight: 42
 	// ✓ Pack/Unpack successful
 }
 
-// Example demonstrates validating the reconstructed tree root
+// Example demonstrates validating the reconstructed tree root.
+// It needs a live subgraph endpoint, so it is compiled but not executed.
 func Example_validateRoot() {
 	ctx := context.Background()
 
@@ -143,7 +175,4 @@ func Example_validateRoot() {
 	}
 
 	fmt.Println("✓ Root validation passed")
-
-	// Output:
-	// ✓ Root validation passed
 }
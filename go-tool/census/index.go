@@ -0,0 +1,54 @@
+package census
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	leanimt "github.com/vocdoni/lean-imt-go"
+)
+
+// indexEntry is the position and weight of an account's leaf
+type indexEntry struct {
+	index  int
+	weight uint64
+}
+
+// AccountIndex maps every account with weight in the census tree to its leaf index and
+// current weight, so lookups do not need to scan the tree leaves.
+type AccountIndex struct {
+	entries map[common.Address]indexEntry
+}
+
+// newAccountIndex creates an empty index
+func newAccountIndex() *AccountIndex {
+	return &AccountIndex{entries: make(map[common.Address]indexEntry)}
+}
+
+// NewAccountIndex indexes the non-empty leaves of an existing tree, e.g. one
+// returned by ReconstructTree or rebuilt from a snapshot.
+func NewAccountIndex(tree *leanimt.LeanIMT[*big.Int]) *AccountIndex {
+	index := newAccountIndex()
+	for i, leaf := range tree.Leaves() {
+		if leaf.Sign() == 0 {
+			continue
+		}
+		account, weight := UnpackLeaf(leaf)
+		index.entries[account] = indexEntry{index: i, weight: weight}
+	}
+	return index
+}
+
+// Lookup returns the leaf index and current weight of the account.
+// ok is false if the account has no weight in the tree.
+func (i *AccountIndex) Lookup(account common.Address) (index int, weight uint64, ok bool) {
+	entry, ok := i.entries[account]
+	if !ok {
+		return -1, 0, false
+	}
+	return entry.index, entry.weight, true
+}
+
+// Len returns the number of accounts with weight in the tree
+func (i *AccountIndex) Len() int {
+	return len(i.entries)
+}
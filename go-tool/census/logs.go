@@ -0,0 +1,258 @@
+package census
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	leanimt "github.com/vocdoni/lean-imt-go"
+
+	bindings "github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+)
+
+// defaultLogChunkSize is the block range requested per eth_getLogs call.
+// Most public RPC providers accept ranges of this size.
+const defaultLogChunkSize = 5000
+
+// LogBackend is the RPC functionality needed to read WeightChanged logs (satisfied by *ethclient.Client)
+type LogBackend interface {
+	bind.ContractFilterer
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// LogAdapter is a SubgraphClient that reads WeightChanged events directly from the
+// contract logs through an RPC endpoint, without relying on The Graph.
+//
+// All logs from the deployment block up to the current head are fetched when the
+// first page (skip == 0) is requested; subsequent pages are served from memory.
+type LogAdapter struct {
+	backend   LogBackend
+	filterer  *bindings.DavinciDaoFilterer
+	fromBlock uint64
+	chunkSize uint64
+	pinned    *uint64 // head block, read from the node on each call if nil
+
+	events []WeightChangeEvent
+}
+
+// NewLogAdapter creates a log-based event source for the contract deployed at the
+// given address. fromBlock should be the contract deployment block; no WeightChanged
+// event can exist before it.
+func NewLogAdapter(backend LogBackend, contract common.Address, fromBlock uint64) (*LogAdapter, error) {
+	filterer, err := bindings.NewDavinciDaoFilterer(contract, backend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind contract filterer: %w", err)
+	}
+
+	return &LogAdapter{
+		backend:   backend,
+		filterer:  filterer,
+		fromBlock: fromBlock,
+		chunkSize: defaultLogChunkSize,
+	}, nil
+}
+
+// SetChunkSize sets the number of blocks requested per eth_getLogs call
+func (a *LogAdapter) SetChunkSize(blocks uint64) {
+	if blocks > 0 {
+		a.chunkSize = blocks
+	}
+}
+
+// GetWeightChangeEvents implements SubgraphClient
+func (a *LogAdapter) GetWeightChangeEvents(ctx context.Context, first int, skip int) ([]WeightChangeEvent, error) {
+	if skip == 0 || a.events == nil {
+		head, err := a.head(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		events, err := a.fetchLogs(ctx, a.fromBlock, head)
+		if err != nil {
+			return nil, err
+		}
+		a.events = events
+	}
+
+	if skip >= len(a.events) {
+		return []WeightChangeEvent{}, nil
+	}
+
+	end := skip + first
+	if end > len(a.events) {
+		end = len(a.events)
+	}
+
+	return a.events[skip:end], nil
+}
+
+// GetWeightChangeEventsAfter implements IncrementalSource.
+// Logs are read chunk by chunk from the cursor block, stopping as soon as first events are
+// found or the current head is reached.
+func (a *LogAdapter) GetWeightChangeEventsAfter(ctx context.Context, after *Cursor, first int) ([]WeightChangeEvent, error) {
+	fromBlock := a.fromBlock
+	if after != nil && after.BlockNumber > fromBlock {
+		fromBlock = after.BlockNumber
+	}
+
+	head, err := a.head(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]WeightChangeEvent, 0)
+	for start := fromBlock; start <= head && len(result) < first; start += a.chunkSize {
+		end := start + a.chunkSize - 1
+		if end > head {
+			end = head
+		}
+
+		events, err := a.fetchLogs(ctx, start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if after == nil || after.Before(e.Cursor()) {
+				result = append(result, e)
+			}
+		}
+	}
+
+	// The next page starts again from the block of the last returned event
+	if len(result) > first {
+		result = result[:first]
+	}
+	return result, nil
+}
+
+// PinLatest implements PinnableSource. It returns an adapter that never reads logs past the
+// current head block.
+func (a *LogAdapter) PinLatest(ctx context.Context) (SubgraphClient, BlockRef, error) {
+	header, err := a.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, BlockRef{}, fmt.Errorf("failed to get head block: %w", err)
+	}
+
+	block := BlockRef{Number: header.Number.Uint64(), Hash: header.Hash()}
+	pinned := *a
+	pinned.pinned = &block.Number
+	pinned.events = nil
+	return &pinned, block, nil
+}
+
+// head returns the pinned block, or else the current head of the node
+func (a *LogAdapter) head(ctx context.Context) (uint64, error) {
+	if a.pinned != nil {
+		return *a.pinned, nil
+	}
+	head, err := a.backend.BlockNumber(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get head block: %w", err)
+	}
+	return head, nil
+}
+
+// BlockHashes implements ReorgSource with the canonical block hashes of the RPC node
+func (a *LogAdapter) BlockHashes(ctx context.Context, numbers []uint64) (map[uint64]common.Hash, error) {
+	hashes := make(map[uint64]common.Hash, len(numbers))
+	for _, number := range numbers {
+		header, err := a.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get header of block %d: %w", number, err)
+		}
+		hashes[number] = header.Hash()
+	}
+	return hashes, nil
+}
+
+// fetchLogs retrieves all WeightChanged events in [from, to] using chunked
+// block ranges and returns them sorted by (blockNumber, logIndex).
+func (a *LogAdapter) fetchLogs(ctx context.Context, from, to uint64) ([]WeightChangeEvent, error) {
+	events := make([]WeightChangeEvent, 0)
+
+	for start := from; start <= to; start += a.chunkSize {
+		end := start + a.chunkSize - 1
+		if end > to {
+			end = to
+		}
+
+		it, err := a.filterer.FilterWeightChanged(&bind.FilterOpts{
+			Start:   start,
+			End:     &end,
+			Context: ctx,
+		}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter logs in blocks %d-%d: %w", start, end, err)
+		}
+
+		for it.Next() {
+			if it.Event.Raw.Removed {
+				continue
+			}
+			event, err := logToEvent(it.Event)
+			if err != nil {
+				it.Close()
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		err = it.Error()
+		it.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate logs in blocks %d-%d: %w", start, end, err)
+		}
+	}
+
+	sortEvents(events)
+	return events, nil
+}
+
+// logToEvent converts a decoded WeightChanged log into a WeightChangeEvent.
+// Weights are uint88 on-chain; a weight that does not fit in 64 bits is an error rather
+// than being truncated into a wrong leaf.
+func logToEvent(e *bindings.DavinciDaoWeightChanged) (WeightChangeEvent, error) {
+	if !e.PreviousWeight.IsUint64() || !e.NewWeight.IsUint64() {
+		return WeightChangeEvent{}, fmt.Errorf("weight of %s at block %d log %d exceeds 64 bits (%s -> %s)",
+			e.Account.Hex(), e.Raw.BlockNumber, e.Raw.Index, e.PreviousWeight, e.NewWeight)
+	}
+
+	return WeightChangeEvent{
+		Account:         e.Account,
+		PreviousWeight:  e.PreviousWeight.Uint64(),
+		NewWeight:       e.NewWeight.Uint64(),
+		BlockNumber:     e.Raw.BlockNumber,
+		BlockTimestamp:  e.Raw.BlockTimestamp,
+		TransactionHash: e.Raw.TxHash,
+		LogIndex:        uint64(e.Raw.Index),
+	}, nil
+}
+
+// ReconstructTreeFromLogs rebuilds the census tree from the contract WeightChanged logs
+// read through an RPC endpoint. It produces the same tree as ReconstructTree without
+// depending on the subgraph.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - backend: RPC client (e.g. *ethclient.Client)
+//   - contract: DavinciDao contract address
+//   - fromBlock: Contract deployment block
+//   - opts: Reconstructor options, e.g. WithProgress
+func ReconstructTreeFromLogs(
+	ctx context.Context,
+	backend LogBackend,
+	contract common.Address,
+	fromBlock uint64,
+	opts ...ReconstructorOption,
+) (*leanimt.LeanIMT[*big.Int], *big.Int, error) {
+	adapter, err := NewLogAdapter(backend, contract, fromBlock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tree, root, _, err := NewTreeReconstructor(adapter, opts...).ReconstructTree(ctx)
+	return tree, root, err
+}
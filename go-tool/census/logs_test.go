@@ -0,0 +1,131 @@
+package census
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	bindings "github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+)
+
+// logChain is an in-memory LogBackend serving WeightChanged logs
+type logChain struct {
+	head    uint64
+	logs    []types.Log
+	queries int
+}
+
+func (c *logChain) FilterLogs(_ context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	c.queries++
+	var logs []types.Log
+	for _, log := range c.logs {
+		if log.BlockNumber >= query.FromBlock.Uint64() && log.BlockNumber <= query.ToBlock.Uint64() {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (c *logChain) SubscribeFilterLogs(context.Context, ethereum.FilterQuery, chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, nil
+}
+
+func (c *logChain) BlockNumber(context.Context) (uint64, error) {
+	return c.head, nil
+}
+
+func (c *logChain) HeaderByNumber(_ context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		number = new(big.Int).SetUint64(c.head)
+	}
+	return &types.Header{Number: number}, nil
+}
+
+// addWeightChanged appends a WeightChanged log
+func (c *logChain) addWeightChanged(t *testing.T, account common.Address, previous, next *big.Int, block uint64, index uint) {
+	t.Helper()
+	parsed, err := bindings.DavinciDaoMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := parsed.Events["WeightChanged"]
+	data, err := event.Inputs.NonIndexed().Pack(previous, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.logs = append(c.logs, types.Log{
+		Topics:      []common.Hash{event.ID, common.BytesToHash(account.Bytes())},
+		Data:        data,
+		BlockNumber: block,
+		Index:       index,
+	})
+}
+
+func TestLogAdapterPaging(t *testing.T) {
+	// Three events every ten blocks, in blocks 100 to 590
+	chain := &logChain{head: 1000}
+	for block := uint64(100); block < 600; block += 10 {
+		for i := uint(0); i < 3; i++ {
+			account := common.BigToAddress(new(big.Int).SetUint64(block*10 + uint64(i)))
+			chain.addWeightChanged(t, account, big.NewInt(0), big.NewInt(1), block, i)
+		}
+	}
+
+	adapter, err := NewLogAdapter(chain, common.Address{}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter.SetChunkSize(50)
+
+	// The first page only needs the first two chunks
+	page, err := adapter.GetWeightChangeEventsAfter(context.Background(), nil, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 20 || chain.queries != 2 {
+		t.Fatalf("first page: %d events in %d queries, want 20 in 2", len(page), chain.queries)
+	}
+
+	var (
+		all   []WeightChangeEvent
+		after *Cursor
+	)
+	for {
+		page, err := adapter.GetWeightChangeEventsAfter(context.Background(), after, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, page...)
+		if len(page) < 20 {
+			break
+		}
+		cursor := page[len(page)-1].Cursor()
+		after = &cursor
+	}
+	if len(all) != len(chain.logs) {
+		t.Fatalf("paged %d events, want %d", len(all), len(chain.logs))
+	}
+	for i := 1; i < len(all); i++ {
+		if !all[i-1].Cursor().Before(all[i].Cursor()) {
+			t.Fatalf("event %d at %+v not after %+v", i, all[i].Cursor(), all[i-1].Cursor())
+		}
+	}
+}
+
+func TestLogAdapterWeightOverflow(t *testing.T) {
+	chain := &logChain{head: 10}
+	chain.addWeightChanged(t, common.HexToAddress("0xa11ce"), big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), 70), 5, 0)
+
+	adapter, err := NewLogAdapter(chain, common.Address{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adapter.GetWeightChangeEventsAfter(context.Background(), nil, 10); err == nil || !strings.Contains(err.Error(), "exceeds 64 bits") {
+		t.Fatalf("error = %v, want weight overflow", err)
+	}
+}
@@ -0,0 +1,100 @@
+package census
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// ProgressStage identifies the step of a reconstruction reported to a ProgressFunc
+type ProgressStage int
+
+const (
+	// StageStarted is reported once before the first page is requested
+	StageStarted ProgressStage = iota
+	// StagePageFetched is reported after each page of events is received
+	StagePageFetched
+	// StageFetchCompleted is reported once all the needed events were fetched
+	StageFetchCompleted
+	// StageEventApplied is reported after each event is replayed on the tree
+	StageEventApplied
+	// StageCompleted is reported once the tree is rebuilt
+	StageCompleted
+)
+
+// Progress describes the state of a reconstruction. Fields that do not apply to the
+// stage are left at their zero value.
+type Progress struct {
+	Stage ProgressStage
+
+	Pages   int // Pages fetched so far
+	Fetched int // Events fetched so far
+	Applied int // Events replayed so far
+
+	Event     WeightChangeEvent // Last replayed event (StageEventApplied)
+	Operation Operation         // Operation performed by Event (StageEventApplied)
+	Index     int               // Leaf index touched by Event (StageEventApplied)
+
+	Size  int       // Tree size, including empty slots
+	Root  *big.Int  // Final root (StageCompleted)
+	Block *BlockRef // Block the events were pinned to, nil if the source is not pinnable
+}
+
+// ProgressFunc receives progress updates from a TreeReconstructor.
+// It is called synchronously, so it should return quickly.
+type ProgressFunc func(Progress)
+
+// ReconstructorOption configures a TreeReconstructor
+type ReconstructorOption func(*TreeReconstructor)
+
+// WithProgress reports the reconstruction progress to fn.
+// Without it the reconstructor produces no output.
+func WithProgress(fn ProgressFunc) ReconstructorOption {
+	return func(r *TreeReconstructor) {
+		r.progress = fn
+	}
+}
+
+// WithPageSize sets the number of events requested per page
+func WithPageSize(size int) ReconstructorOption {
+	return func(r *TreeReconstructor) {
+		if size > 0 {
+			r.pageSize = size
+		}
+	}
+}
+
+// PrettyProgress returns a ProgressFunc writing human readable progress to w, as used by
+// the CLI tools. Only the first 10 operations and every 100th one are printed.
+func PrettyProgress(w io.Writer) ProgressFunc {
+	return func(p Progress) {
+		switch p.Stage {
+		case StageStarted:
+			fmt.Fprintln(w, "🔄 Reconstructing census tree from WeightChanged events...")
+		case StageFetchCompleted:
+			fmt.Fprintf(w, "   ├─ Fetched %d WeightChanged events\n", p.Fetched)
+			if p.Block != nil {
+				fmt.Fprintf(w, "   ├─ Pinned to block %d (%s)\n", p.Block.Number, p.Block.Hash.Hex())
+			}
+			fmt.Fprintln(w, "   ├─ Replaying events to reconstruct tree...")
+		case StageEventApplied:
+			if p.Applied%100 != 0 && p.Applied > 10 {
+				return
+			}
+			account := p.Event.Account.Hex()[:10]
+			switch p.Operation {
+			case OpInsert:
+				fmt.Fprintf(w, "   │   INSERT %s weight=%d (tree size: %d)\n", account, p.Event.NewWeight, p.Size)
+			case OpRemove:
+				fmt.Fprintf(w, "   │   REMOVE %s at index %d (tree size: %d)\n", account, p.Index, p.Size)
+			case OpUpdate:
+				fmt.Fprintf(w, "   │   UPDATE %s weight %d→%d at index %d\n",
+					account, p.Event.PreviousWeight, p.Event.NewWeight, p.Index)
+			}
+		case StageCompleted:
+			fmt.Fprintf(w, "   ├─ Tree reconstruction complete\n")
+			fmt.Fprintf(w, "   ├─ Tree size: %d (including empty slots)\n", p.Size)
+			fmt.Fprintf(w, "   └─ Root: 0x%x\n", p.Root)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package census
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	leanimt "github.com/vocdoni/lean-imt-go"
+
+	bindings "github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+)
+
+// ErrNotInTree is returned when an account has no weight in the census tree.
+// Such accounts need no proof: pass a current weight of 0 and an empty proof to the contract.
+var ErrNotInTree = errors.New("account is not in the census tree")
+
+// ProofFor looks up the current leaf of the account and returns a proof ready to be
+// submitted to the contract (undelegate / updateDelegation fromProofs). For the `to`
+// argument of delegate / updateDelegation use proof.CurrentWeight and proof.Siblings.
+//
+// Returns ErrNotInTree if the account has zero weight.
+func ProofFor(tree *leanimt.LeanIMT[*big.Int], account common.Address) (*bindings.DavinciDaoProofInput, error) {
+	return proofFor(tree, NewAccountIndex(tree), account)
+}
+
+// proofFor resolves the account through the index and generates its proof
+func proofFor(tree *leanimt.LeanIMT[*big.Int], accounts *AccountIndex, account common.Address) (*bindings.DavinciDaoProofInput, error) {
+	index, weight, ok := accounts.Lookup(account)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotInTree, account.Hex())
+	}
+	return proofAt(tree, account, index, weight)
+}
+
+// proofAt generates the proof for the leaf at index, which must hold (account, weight)
+func proofAt(tree *leanimt.LeanIMT[*big.Int], account common.Address, index int, weight uint64) (*bindings.DavinciDaoProofInput, error) {
+	proof, err := tree.GenerateProof(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate proof for %s: %w", account.Hex(), err)
+	}
+
+	siblings := make([]*big.Int, len(proof.Siblings))
+	for i, sibling := range proof.Siblings {
+		siblings[i] = new(big.Int).Set(sibling)
+	}
+
+	return &bindings.DavinciDaoProofInput{
+		Account:       account,
+		CurrentWeight: new(big.Int).SetUint64(weight),
+		Siblings:      siblings,
+	}, nil
+}
+
+// ProofFor returns a contract-ready proof for the account from the synced tree.
+// Returns ErrNotInTree if the account has zero weight.
+func (s *Syncer) ProofFor(account common.Address) (*bindings.DavinciDaoProofInput, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return proofFor(s.tree, s.accounts, account)
+}
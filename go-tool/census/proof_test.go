@@ -0,0 +1,67 @@
+package census
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	leanimt "github.com/vocdoni/lean-imt-go"
+)
+
+func TestProofForAndVerifyProof(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		tree, err := leanimt.New(leanimt.PoseidonHasher, leanimt.BigIntEqual, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts := make([]common.Address, size)
+		for i := range accounts {
+			accounts[i] = common.BigToAddress(big.NewInt(int64(1000 + i)))
+			if err := tree.Insert(PackLeaf(accounts[i], uint64(i+1))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root := treeRoot(tree)
+
+		for i, account := range accounts {
+			proof, err := ProofFor(tree, account)
+			if err != nil {
+				t.Fatalf("size %d: ProofFor(%d): %v", size, i, err)
+			}
+			if proof.CurrentWeight.Uint64() != uint64(i+1) {
+				t.Fatalf("size %d: leaf %d weight %s, want %d", size, i, proof.CurrentWeight, i+1)
+			}
+			if !VerifyProof(root, account, uint64(i+1), i, proof.Siblings) {
+				t.Fatalf("size %d: valid proof for leaf %d rejected", size, i)
+			}
+			if VerifyProof(root, account, uint64(i+2), i, proof.Siblings) {
+				t.Fatalf("size %d: proof for leaf %d accepted with wrong weight", size, i)
+			}
+			if size > 1 && VerifyProof(root, account, uint64(i+1), (i+1)%size, proof.Siblings) {
+				t.Fatalf("size %d: proof for leaf %d accepted with wrong index", size, i)
+			}
+		}
+	}
+}
+
+func TestProofForNotInTree(t *testing.T) {
+	tree, err := leanimt.New(leanimt.PoseidonHasher, leanimt.BigIntEqual, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+	accounts := newAccountIndex()
+	for _, event := range []WeightChangeEvent{
+		{Account: account, PreviousWeight: 0, NewWeight: 1},
+		{Account: account, PreviousWeight: 1, NewWeight: 0},
+	} {
+		if _, _, err := applyEvent(tree, accounts, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ProofFor(tree, account); !errors.Is(err, ErrNotInTree) {
+		t.Fatalf("ProofFor error = %v, want ErrNotInTree", err)
+	}
+}
@@ -2,26 +2,44 @@ package census
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
-	"strconv"
 
 	"github.com/ethereum/go-ethereum/common"
 	leanimt "github.com/vocdoni/lean-imt-go"
 
+	bindings "github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
 	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
 )
 
-// weightChangeEvent represents a weight change event from the subgraph
-type weightChangeEvent struct {
-	accountID       string // lowercase address
-	accountAddress  string // original case address
-	previousWeight  string
-	newWeight       string
-	blockNumber     string
-	blockTimestamp  string
-	transactionHash string
-	logIndex        string
+// defaultPageSize is the number of events requested per page from the event source
+const defaultPageSize = 1000
+
+// TreeReconstructor rebuilds the census tree from the WeightChanged events
+// returned by a SubgraphClient.
+type TreeReconstructor struct {
+	client   SubgraphClient
+	pageSize int
+	progress ProgressFunc
+
+	// Last reconstructed tree, its account index and the block it was pinned to
+	tree     *leanimt.LeanIMT[*big.Int]
+	accounts *AccountIndex
+	block    *BlockRef
+}
+
+// NewTreeReconstructor creates a reconstructor reading events from the given source.
+// It produces no output unless a progress reporter is set with WithProgress.
+func NewTreeReconstructor(client SubgraphClient, opts ...ReconstructorOption) *TreeReconstructor {
+	r := &TreeReconstructor{
+		client:   client,
+		pageSize: defaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // ReconstructTree rebuilds the census tree by replaying all WeightChanged events from the subgraph.
@@ -31,153 +49,228 @@ type weightChangeEvent struct {
 // Parameters:
 //   - ctx: Context for cancellation
 //   - subgraphURL: The Graph subgraph endpoint URL
+//   - opts: Reconstructor options, e.g. WithProgress
 //
 // Returns:
 //   - tree: The reconstructed LeanIMT tree with correct structure
 //   - root: The tree root as *big.Int
 //   - err: Any error encountered during reconstruction
-func ReconstructTree(ctx context.Context, subgraphURL string) (*leanimt.LeanIMT[*big.Int], *big.Int, error) {
-	client := subgraph.NewClient(subgraphURL)
-	fmt.Println("🔄 Reconstructing census tree from subgraph events...")
+func ReconstructTree(ctx context.Context, subgraphURL string, opts ...ReconstructorOption) (*leanimt.LeanIMT[*big.Int], *big.Int, error) {
+	reconstructor := NewTreeReconstructor(NewSubgraphAdapter(subgraph.NewClient(subgraphURL)), opts...)
+	tree, root, _, err := reconstructor.ReconstructTree(ctx)
+	return tree, root, err
+}
+
+// ErrRootNotFound is returned by ReconstructTreeAtRoot when replaying all events never
+// produces the requested root.
+var ErrRootNotFound = errors.New("census root not found in event history")
+
+// ErrBlockNotIndexed is returned by ReconstructTreeAt when the requested block is past
+// the latest block indexed by the source.
+var ErrBlockNotIndexed = errors.New("block not indexed yet")
+
+// ReconstructTree fetches all events from the source and replays them in order.
+//
+// Returns:
+//   - tree: The reconstructed LeanIMT tree with correct structure
+//   - root: The tree root as *big.Int (0 for an empty tree)
+//   - size: The number of leaves, including empty slots
+//   - err: Any error encountered during reconstruction
+func (r *TreeReconstructor) ReconstructTree(ctx context.Context) (*leanimt.LeanIMT[*big.Int], *big.Int, int, error) {
+	return r.reconstruct(ctx, nil, nil)
+}
+
+// ReconstructTreeAt rebuilds the tree as it was at the end of the given block, replaying
+// only the events recorded up to (and including) that block. Use it together with the
+// contract's getRootBlockNumber to rebuild the tree a proposal snapshotted.
+// With a PinnableSource it returns ErrBlockNotIndexed if the block is past the indexed head.
+func (r *TreeReconstructor) ReconstructTreeAt(ctx context.Context, block uint64) (*leanimt.LeanIMT[*big.Int], *big.Int, int, error) {
+	return r.reconstruct(ctx, &block, nil)
+}
+
+// ReconstructTreeAtRoot rebuilds the tree as it was when the given census root was set
+// (CensusRootUpdated), stopping at the first event that produces that root.
+// It returns ErrRootNotFound if no prefix of the event history produces the root.
+func (r *TreeReconstructor) ReconstructTreeAtRoot(ctx context.Context, root *big.Int) (*leanimt.LeanIMT[*big.Int], *big.Int, int, error) {
+	return r.reconstruct(ctx, nil, root)
+}
+
+// AccountIndex returns the address→index map of the last reconstructed tree,
+// or nil if no tree was reconstructed yet.
+func (r *TreeReconstructor) AccountIndex() *AccountIndex {
+	return r.accounts
+}
+
+// ProofFor returns a contract-ready proof for the account from the last reconstructed tree.
+// Returns ErrNotInTree if the account has zero weight.
+func (r *TreeReconstructor) ProofFor(account common.Address) (*bindings.DavinciDaoProofInput, error) {
+	if r.tree == nil {
+		return nil, fmt.Errorf("no tree reconstructed yet")
+	}
+	return proofFor(r.tree, r.accounts, account)
+}
+
+// Block returns the block the last reconstructed tree corresponds to, or nil if the
+// source does not support pinning (PinnableSource). After ReconstructTreeAt it is the
+// requested block, with a zero hash unless it is the indexed head.
+func (r *TreeReconstructor) Block() *BlockRef {
+	if r.block == nil {
+		return nil
+	}
+	block := *r.block
+	return &block
+}
+
+// report sends p to the progress reporter, if any
+func (r *TreeReconstructor) report(p Progress) {
+	if r.progress != nil {
+		r.progress(p)
+	}
+}
+
+// fetchPage requests the page following the fetched events, by cursor if the source
+// supports it (no skip limit, deterministic order) and by skip otherwise
+func (r *TreeReconstructor) fetchPage(
+	ctx context.Context,
+	client SubgraphClient,
+	fetched []WeightChangeEvent,
+	skip int,
+) ([]WeightChangeEvent, error) {
+	source, ok := client.(IncrementalSource)
+	if !ok {
+		return client.GetWeightChangeEvents(ctx, r.pageSize, skip)
+	}
+
+	var after *Cursor
+	if len(fetched) > 0 {
+		cursor := fetched[len(fetched)-1].Cursor()
+		after = &cursor
+	}
+	return source.GetWeightChangeEventsAfter(ctx, after, r.pageSize)
+}
 
-	// Step 1: Fetch ALL WeightChanged events in chronological order
-	var allEvents []weightChangeEvent
+// reconstruct fetches events in chronological order and replays them. If maxBlock is set,
+// events after that block are ignored. If targetRoot is set, replay stops as soon as the
+// tree root equals it.
+func (r *TreeReconstructor) reconstruct(
+	ctx context.Context,
+	maxBlock *uint64,
+	targetRoot *big.Int,
+) (*leanimt.LeanIMT[*big.Int], *big.Int, int, error) {
+	r.report(Progress{Stage: StageStarted})
+
+	// Step 1: Pin the source to its latest block, so all pages read the same state
+	client := r.client
+	var block *BlockRef
+	if source, ok := client.(PinnableSource); ok {
+		pinned, ref, err := source.PinLatest(ctx)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		client, block = pinned, &ref
+
+		if maxBlock != nil {
+			if *maxBlock > ref.Number {
+				return nil, nil, 0, fmt.Errorf("%w: requested block %d, indexed head %d", ErrBlockNotIndexed, *maxBlock, ref.Number)
+			}
+			if *maxBlock < ref.Number {
+				// The tree corresponds to the requested block, whose hash is not known
+				block = &BlockRef{Number: *maxBlock}
+			}
+		}
+	}
+
+	// Step 2: Fetch WeightChanged events in chronological order
+	var allEvents []WeightChangeEvent
 	skip := 0
-	pageSize := 1000
+	pages := 0
 
 	for {
-		events, err := client.GetWeightChangeEvents(ctx, pageSize, skip)
+		events, err := r.fetchPage(ctx, client, allEvents, skip)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to fetch events: %w", err)
+			return nil, nil, 0, fmt.Errorf("failed to fetch events: %w", err)
 		}
 
 		if len(events) == 0 {
 			break
 		}
 
-		// Convert to internal format
-		for _, e := range events {
-			allEvents = append(allEvents, weightChangeEvent{
-				accountID:       e.Account.ID,
-				accountAddress:  e.Account.Address,
-				previousWeight:  e.PreviousWeight,
-				newWeight:       e.NewWeight,
-				blockNumber:     e.BlockNumber,
-				blockTimestamp:  e.BlockTimestamp,
-				transactionHash: e.TransactionHash,
-				logIndex:        e.LogIndex,
-			})
-		}
-
-		skip += pageSize
+		allEvents = append(allEvents, events...)
+		skip += len(events)
+		pages++
+		r.report(Progress{Stage: StagePageFetched, Pages: pages, Fetched: len(allEvents)})
 
-		if len(events) < pageSize {
+		if len(events) < r.pageSize {
 			break
 		}
-	}
-
-	fmt.Printf("   ├─ Fetched %d WeightChanged events\n", len(allEvents))
-
-	if len(allEvents) == 0 {
-		fmt.Println("   └─ ⚠️  No events found, tree is empty")
-		// Return empty tree with root = 0
-		// Note: Empty LeanIMT tree has no root (tree.Root() returns false)
-		// but the contract returns 0 for empty tree, so we return 0 here
-		tree, err := leanimt.New(leanimt.PoseidonHasher, leanimt.BigIntEqual, nil, nil, nil)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to create empty tree: %w", err)
+		// No need to fetch further pages once we are past the requested block
+		if maxBlock != nil && events[len(events)-1].BlockNumber > *maxBlock {
+			break
 		}
-		fmt.Println("   └─ Root: 0x0 (empty tree)")
-		return tree, big.NewInt(0), nil
 	}
 
-	// Step 2: Create tree with Poseidon hash (matching contract)
+	r.report(Progress{Stage: StageFetchCompleted, Pages: pages, Fetched: len(allEvents), Block: block})
+
+	// Step 3: Create tree with Poseidon hash (matching contract)
 	tree, err := leanimt.New(leanimt.PoseidonHasher, leanimt.BigIntEqual, nil, nil, nil)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create tree: %w", err)
+		return nil, nil, 0, fmt.Errorf("failed to create tree: %w", err)
 	}
+	accounts := newAccountIndex()
 
-	// Step 3: Replay all events in chronological order
-	fmt.Println("   ├─ Replaying events to reconstruct tree...")
+	// The contract returns 0 as the root of the empty tree
+	found := targetRoot != nil && targetRoot.Sign() == 0
 
+	// Step 4: Replay events in chronological order
+	applied := 0
 	for i, event := range allEvents {
-		prevWeight, err := strconv.ParseUint(event.previousWeight, 10, 64)
-		if err != nil {
-			return nil, nil, fmt.Errorf("invalid previousWeight in event %d: %w", i, err)
+		if found || (maxBlock != nil && event.BlockNumber > *maxBlock) {
+			break
 		}
 
-		newWeight, err := strconv.ParseUint(event.newWeight, 10, 64)
+		op, index, err := applyEvent(tree, accounts, event)
 		if err != nil {
-			return nil, nil, fmt.Errorf("invalid newWeight in event %d: %w", i, err)
+			return nil, nil, 0, fmt.Errorf("event %d: %w", i, err)
 		}
-
-		// Parse account address
-		accountAddr := common.HexToAddress(event.accountID)
-
-		// Pack leaves: (address << 88) | weight
-		addr := new(big.Int).SetBytes(accountAddr.Bytes())
-		oldLeaf := new(big.Int).Lsh(addr, 88)
-		oldLeaf.Or(oldLeaf, big.NewInt(int64(prevWeight)))
-
-		newLeaf := new(big.Int).Lsh(addr, 88)
-		newLeaf.Or(newLeaf, big.NewInt(int64(newWeight)))
-
-		// Determine operation type and execute
-		if prevWeight == 0 && newWeight > 0 {
-			// INSERT: New account getting weight
-			if err := tree.Insert(newLeaf); err != nil {
-				return nil, nil, fmt.Errorf("insert failed for event %d: %w", i, err)
-			}
-			if (i+1)%100 == 0 || i < 10 {
-				fmt.Printf("   │   INSERT %s weight=%d (tree size: %d)\n",
-					accountAddr.Hex()[:10], newWeight, tree.Size())
-			}
-
-		} else if newWeight == 0 && prevWeight > 0 {
-			// REMOVE: Account weight going to 0
-			// CRITICAL: tree.Update(index, 0) sets the leaf to 0 but KEEPS the slot
-			// The tree size doesn't decrease - it maintains an empty slot at that index
-			index := tree.IndexOf(oldLeaf)
-			if index == -1 {
-				return nil, nil, fmt.Errorf("remove failed: leaf not found for %s in event %d",
-					accountAddr.Hex(), i)
-			}
-			if err := tree.Update(index, big.NewInt(0)); err != nil {
-				return nil, nil, fmt.Errorf("remove (update to 0) failed for event %d: %w", i, err)
-			}
-			if (i+1)%100 == 0 || i < 10 {
-				fmt.Printf("   │   REMOVE %s at index %d (tree size: %d)\n",
-					accountAddr.Hex()[:10], index, tree.Size())
-			}
-
-		} else if prevWeight > 0 && newWeight > 0 {
-			// UPDATE: Weight change (both > 0)
-			index := tree.IndexOf(oldLeaf)
-			if index == -1 {
-				return nil, nil, fmt.Errorf("update failed: leaf not found for %s in event %d",
-					accountAddr.Hex(), i)
-			}
-			if err := tree.Update(index, newLeaf); err != nil {
-				return nil, nil, fmt.Errorf("update failed for event %d: %w", i, err)
-			}
-			if (i+1)%100 == 0 || i < 10 {
-				fmt.Printf("   │   UPDATE %s weight %d→%d at index %d\n",
-					accountAddr.Hex()[:10], prevWeight, newWeight, index)
-			}
+		applied++
+		if targetRoot != nil && treeRoot(tree).Cmp(targetRoot) == 0 {
+			found = true
 		}
+		r.report(Progress{
+			Stage:     StageEventApplied,
+			Pages:     pages,
+			Fetched:   len(allEvents),
+			Applied:   applied,
+			Event:     event,
+			Operation: op,
+			Index:     index,
+			Size:      tree.Size(),
+		})
 	}
 
-	// Step 4: Get final root
-	root, exists := tree.Root()
-	if !exists {
-		return nil, nil, fmt.Errorf("tree root does not exist after reconstruction")
+	if targetRoot != nil && !found {
+		return nil, nil, 0, fmt.Errorf("%w: 0x%x", ErrRootNotFound, targetRoot)
 	}
 
-	fmt.Printf("   ├─ Tree reconstruction complete\n")
-	fmt.Printf("   ├─ Tree size: %d (including empty slots)\n", tree.Size())
-	fmt.Printf("   └─ Root: 0x%x\n", root)
-
-	return tree, root, nil
+	// Step 5: Get final root
+	// Note: Empty LeanIMT tree has no root (tree.Root() returns false)
+	// but the contract returns 0 for empty tree, so we return 0 here
+	root := treeRoot(tree)
+
+	r.report(Progress{
+		Stage:   StageCompleted,
+		Pages:   pages,
+		Fetched: len(allEvents),
+		Applied: applied,
+		Size:    tree.Size(),
+		Root:    root,
+		Block:   block,
+	})
+
+	r.tree = tree
+	r.accounts = accounts
+	r.block = block
+	return tree, root, tree.Size(), nil
 }
 
 // PackLeaf packs an address and weight into a leaf value (matches contract implementation)
@@ -0,0 +1,43 @@
+package census_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/census"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+func TestReconstructTreeAt(t *testing.T) {
+	alice := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{
+		Head: 20,
+		WeightChangeEvents: []subgraphtest.WeightChange{
+			{Account: alice, PreviousWeight: 0, NewWeight: 2, BlockNumber: 10, LogIndex: 0},
+			{Account: bob, PreviousWeight: 0, NewWeight: 1, BlockNumber: 12, LogIndex: 0},
+		},
+	})
+	defer server.Close()
+	reconstructor := census.NewTreeReconstructor(census.NewSubgraphAdapter(server.Client()))
+
+	_, _, size, err := reconstructor.ReconstructTreeAt(context.Background(), 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 1 {
+		t.Fatalf("size at block 11 = %d, want 1", size)
+	}
+	if block := reconstructor.Block(); block == nil || block.Number != 11 {
+		t.Fatalf("Block() = %+v, want block 11", block)
+	}
+
+	// Past the indexed head the tree would silently be the one of the head
+	if _, _, _, err := reconstructor.ReconstructTreeAt(context.Background(), 21); !errors.Is(err, census.ErrBlockNotIndexed) {
+		t.Fatalf("ReconstructTreeAt(21) error = %v, want ErrBlockNotIndexed", err)
+	}
+}
@@ -0,0 +1,205 @@
+package census
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultReorgDepth is the number of recent blocks whose applied events can be rolled back
+const defaultReorgDepth = 64
+
+// ErrReorgTooDeep is returned by Sync when a reorg goes past the blocks already pruned from
+// the undo log. The tree must then be rebuilt from scratch.
+var ErrReorgTooDeep = errors.New("chain reorganization is deeper than the undo log")
+
+// ErrUnknownBlockHash is returned by Sync when the source does not know the hash of a block
+// needed to check for reorgs. The undo log is kept, and the check is retried on the next Sync.
+var ErrUnknownBlockHash = errors.New("block hash unknown to the source")
+
+// undoEntry records an applied event so that it can be reverted after a reorg
+type undoEntry struct {
+	event      WeightChangeEvent
+	op         Operation
+	index      int
+	prevCursor *Cursor // cursor before the event was applied
+}
+
+// SetReorgDepth sets how many blocks below the head are kept in the undo log. Reorgs deeper
+// than that cannot be rolled back and make Sync fail with ErrReorgTooDeep.
+func (s *Syncer) SetReorgDepth(blocks uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reorgDepth = blocks
+}
+
+// record appends an applied event to the undo log. Must be called with the write lock held.
+func (s *Syncer) record(event WeightChangeEvent, op Operation, index int, prevCursor *Cursor) {
+	s.undo = append(s.undo, undoEntry{event: event, op: op, index: index, prevCursor: prevCursor})
+}
+
+// checkpoint records the block the events were fetched at, whose hash vouches for all the
+// events applied up to it, and prunes the checkpoints and events deeper than the reorg
+// depth below it
+func (s *Syncer) checkpoint(head BlockRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := len(s.checkpoints); n == 0 || s.checkpoints[n-1].Number < head.Number {
+		s.checkpoints = append(s.checkpoints, head)
+	}
+
+	// The newest checkpoint is always kept, as it is the one checked first
+	drop := 0
+	for drop < len(s.checkpoints)-1 && s.checkpoints[drop].Number+s.reorgDepth < head.Number {
+		drop++
+	}
+	if drop == 0 {
+		return
+	}
+	pruned := s.checkpoints[drop-1]
+	s.pruned = &pruned
+	s.checkpoints = append(s.checkpoints[:0:0], s.checkpoints[drop:]...)
+
+	// Events up to the newest pruned checkpoint can no longer be rolled back
+	keep := 0
+	for keep < len(s.undo) && s.undo[keep].event.BlockNumber <= pruned.Number {
+		keep++
+	}
+	if keep > 0 {
+		s.undo = append(s.undo[:0:0], s.undo[keep:]...)
+	}
+}
+
+// checkReorg compares the hashes of the checkpoints with the canonical ones. On divergence,
+// the events after the newest checkpoint that is still canonical are rolled back so that the
+// next fetch replays the canonical ones. It returns the number of events rolled back.
+//
+// A checkpoint whose canonical hash is unknown is neither canonical nor orphaned: the latest
+// one makes the check fail with ErrUnknownBlockHash, older ones are skipped when looking for
+// the common ancestor, which can only roll back more events than needed.
+func (s *Syncer) checkReorg(ctx context.Context) (int, error) {
+	source, ok := s.source.(ReorgSource)
+	if !ok {
+		return 0, nil
+	}
+
+	s.mu.RLock()
+	checkpoints := append([]BlockRef(nil), s.checkpoints...)
+	var pruned *BlockRef
+	if s.pruned != nil {
+		ref := *s.pruned
+		pruned = &ref
+	}
+	s.mu.RUnlock()
+	if len(checkpoints) == 0 {
+		return 0, nil
+	}
+
+	// Common case: the latest checkpoint is still canonical
+	latest := checkpoints[len(checkpoints)-1]
+	canonical, err := source.BlockHashes(ctx, []uint64{latest.Number})
+	if err != nil {
+		return 0, fmt.Errorf("failed to check for reorgs: %w", err)
+	}
+	hash, known := canonical[latest.Number]
+	if !known {
+		return 0, fmt.Errorf("failed to check for reorgs: %w (block %d)", ErrUnknownBlockHash, latest.Number)
+	}
+	if hash == latest.Hash {
+		return 0, nil
+	}
+
+	// Find the newest checkpoint that is still canonical (the common ancestor), newest first
+	var numbers []uint64
+	for i := len(checkpoints) - 2; i >= 0; i-- {
+		numbers = append(numbers, checkpoints[i].Number)
+	}
+	if pruned != nil {
+		numbers = append(numbers, pruned.Number)
+	}
+	if len(numbers) > 0 {
+		canonical, err = source.BlockHashes(ctx, numbers)
+		if err != nil {
+			return 0, fmt.Errorf("failed to find reorg ancestor: %w", err)
+		}
+	}
+	for i := len(checkpoints) - 2; i >= 0; i-- {
+		if hash, known := canonical[checkpoints[i].Number]; known && hash == checkpoints[i].Hash {
+			return s.rollback(&checkpoints[i].Number)
+		}
+	}
+
+	// Every event still in the undo log comes after the pruned blocks, so all of them can be
+	// rolled back as long as the reorg does not reach the pruned ones
+	if pruned == nil {
+		return s.rollback(nil)
+	}
+	hash, known = canonical[pruned.Number]
+	switch {
+	case !known || pruned.Hash == (common.Hash{}):
+		return 0, fmt.Errorf("failed to find reorg ancestor: %w (block %d)", ErrUnknownBlockHash, pruned.Number)
+	case hash == pruned.Hash:
+		return s.rollback(nil)
+	default:
+		return 0, fmt.Errorf("%w: block %d is no longer canonical", ErrReorgTooDeep, pruned.Number)
+	}
+}
+
+// rollback reverts the events applied after the given block (all the undo log if nil),
+// rebuilding the tree and the account index, and moves the cursor back accordingly
+func (s *Syncer) rollback(block *uint64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	after := func(number uint64) bool { return block == nil || number > *block }
+
+	keep := len(s.checkpoints)
+	for keep > 0 && after(s.checkpoints[keep-1].Number) {
+		keep--
+	}
+	s.checkpoints = s.checkpoints[:keep]
+
+	first := len(s.undo)
+	for first > 0 && after(s.undo[first-1].event.BlockNumber) {
+		first--
+	}
+	if first == len(s.undo) {
+		return 0, nil
+	}
+
+	leaves := copyLeaves(s.tree.Leaves())
+	for i := len(s.undo) - 1; i >= first; i-- {
+		entry := s.undo[i]
+		switch entry.op {
+		case OpInsert:
+			leaves = leaves[:entry.index]
+		case OpRemove, OpUpdate:
+			leaves[entry.index] = PackLeaf(entry.event.Account, entry.event.PreviousWeight)
+		}
+	}
+
+	tree, err := newTreeFromLeaves(leaves)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild tree after reorg: %w", err)
+	}
+
+	reverted := len(s.undo) - first
+	s.tree = tree
+	s.accounts = NewAccountIndex(tree)
+	s.cursor = s.undo[first].prevCursor
+	s.undo = s.undo[:first]
+	return reverted, nil
+}
+
+// copyLeaves returns a copy of the leaf values, so that rollbacks never alias the live tree
+func copyLeaves(leaves []*big.Int) []*big.Int {
+	copied := make([]*big.Int, len(leaves))
+	for i, leaf := range leaves {
+		copied[i] = new(big.Int).Set(leaf)
+	}
+	return copied
+}
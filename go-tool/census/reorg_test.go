@@ -0,0 +1,259 @@
+package census
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// chainSource is a sliceSource pinned to a head block that also reports the canonical
+// block hashes
+type chainSource struct {
+	sliceSource
+	head   uint64
+	hashes map[uint64]common.Hash
+}
+
+func (s *chainSource) GetWeightChangeEventsAfter(ctx context.Context, after *Cursor, first int) ([]WeightChangeEvent, error) {
+	events, err := s.sliceSource.GetWeightChangeEventsAfter(ctx, after, first)
+	var result []WeightChangeEvent
+	for _, e := range events {
+		if e.BlockNumber <= s.head {
+			result = append(result, e)
+		}
+	}
+	return result, err
+}
+
+func (s *chainSource) PinLatest(context.Context) (SubgraphClient, BlockRef, error) {
+	return s, BlockRef{Number: s.head, Hash: s.hashes[s.head]}, nil
+}
+
+func (s *chainSource) GetWeightChangeEvents(context.Context, int, int) ([]WeightChangeEvent, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *chainSource) BlockHashes(_ context.Context, numbers []uint64) (map[uint64]common.Hash, error) {
+	hashes := make(map[uint64]common.Hash, len(numbers))
+	for _, number := range numbers {
+		if hash, ok := s.hashes[number]; ok {
+			hashes[number] = hash
+		}
+	}
+	return hashes, nil
+}
+
+func newChainSource(events []WeightChangeEvent) *chainSource {
+	return &chainSource{
+		sliceSource: sliceSource{events: events},
+		hashes: map[uint64]common.Hash{
+			10: common.HexToHash("0x10"),
+			11: common.HexToHash("0x11"),
+			12: common.HexToHash("0x12"),
+			13: common.HexToHash("0x13"),
+		},
+	}
+}
+
+// syncAt syncs with the source head at the given block
+func syncAt(t *testing.T, syncer *Syncer, source *chainSource, head uint64) int {
+	t.Helper()
+	source.head = head
+	applied, err := syncer.Sync(context.Background())
+	if err != nil {
+		t.Fatalf("sync at block %d: %v", head, err)
+	}
+	return applied
+}
+
+// checkReplay checks that the syncer matches a full replay of the events
+func checkReplay(t *testing.T, syncer *Syncer, events []WeightChangeEvent) {
+	t.Helper()
+	full, err := NewSyncer(&sliceSource{events: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := full.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if syncer.Root().Cmp(full.Root()) != 0 {
+		t.Fatalf("root after reorg 0x%x, full replay root 0x%x", syncer.Root(), full.Root())
+	}
+	if syncer.Size() != full.Size() {
+		t.Fatalf("size after reorg %d, want %d", syncer.Size(), full.Size())
+	}
+	if cursor, want := syncer.Cursor(), events[len(events)-1].Cursor(); cursor == nil || *cursor != want {
+		t.Fatalf("cursor after reorg = %v, want %v", cursor, want)
+	}
+}
+
+func TestSyncerReorg(t *testing.T) {
+	events := testEvents()
+	source := newChainSource(events)
+
+	syncer, err := NewSyncer(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for head := uint64(11); head <= 13; head++ {
+		syncAt(t, syncer, source, head)
+	}
+
+	// Blocks 12 and 13 are replaced: bob keeps his weight and carol gets a different one
+	carol := events[4].Account
+	canonical := append(events[:3:3],
+		WeightChangeEvent{Account: carol, PreviousWeight: 0, NewWeight: 7, BlockNumber: 12, LogIndex: 1})
+	source.events = canonical
+	source.hashes[12] = common.HexToHash("0x1200")
+	source.hashes[13] = common.HexToHash("0x1300")
+
+	if applied := syncAt(t, syncer, source, 13); applied != 1 {
+		t.Fatalf("applied %d events after reorg, want 1", applied)
+	}
+	checkReplay(t, syncer, canonical)
+	if _, weight, ok := syncer.Lookup(events[1].Account); !ok || weight != 1 {
+		t.Fatalf("bob weight after reorg = (%d, %v), want (1, true)", weight, ok)
+	}
+	if _, weight, _ := syncer.Lookup(carol); weight != 7 {
+		t.Fatalf("carol weight after reorg = %d, want 7", weight)
+	}
+}
+
+func TestSyncerSingleBlockReorg(t *testing.T) {
+	events := testEvents()
+	source := newChainSource(events)
+
+	// A single sync: the orphaned block is the only one recorded
+	syncer, err := NewSyncer(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncAt(t, syncer, source, 13)
+
+	carol := events[4].Account
+	canonical := append(events[:4:4],
+		WeightChangeEvent{Account: carol, PreviousWeight: 0, NewWeight: 9, BlockNumber: 13, LogIndex: 0})
+	source.events = canonical
+	source.hashes[13] = common.HexToHash("0x1300")
+
+	if applied := syncAt(t, syncer, source, 13); applied != len(canonical) {
+		t.Fatalf("applied %d events after reorg, want %d", applied, len(canonical))
+	}
+	checkReplay(t, syncer, canonical)
+
+	// A block the source has no hash for is an error, not the absence of a reorg
+	delete(source.hashes, 13)
+	if _, err := syncer.Sync(context.Background()); !errors.Is(err, ErrUnknownBlockHash) {
+		t.Fatalf("Sync error = %v, want ErrUnknownBlockHash", err)
+	}
+}
+
+func TestSyncerReorgTooDeep(t *testing.T) {
+	events := testEvents()
+	source := newChainSource(events)
+
+	syncer, err := NewSyncer(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncer.SetReorgDepth(1)
+	for head := uint64(10); head <= 13; head++ {
+		syncAt(t, syncer, source, head)
+	}
+
+	// Block 11 is pruned but still canonical: the events of 12 and 13 are rolled back
+	canonical := events[:4:4]
+	source.events = canonical
+	source.hashes[12] = common.HexToHash("0x1200")
+	source.hashes[13] = common.HexToHash("0x1300")
+	if applied := syncAt(t, syncer, source, 13); applied != 1 {
+		t.Fatalf("applied %d events after reorg, want 1", applied)
+	}
+	checkReplay(t, syncer, canonical)
+
+	// A reorg reaching a pruned block cannot be rolled back
+	source.hashes[11] = common.HexToHash("0x1100")
+	source.hashes[12] = common.HexToHash("0x12")
+	source.hashes[13] = common.HexToHash("0x13")
+	if _, err := syncer.Sync(context.Background()); !errors.Is(err, ErrReorgTooDeep) {
+		t.Fatalf("Sync error = %v, want ErrReorgTooDeep", err)
+	}
+}
+
+func TestSyncerPrunesAgainstHead(t *testing.T) {
+	source := newChainSource(testEvents())
+	source.hashes[100] = common.HexToHash("0x100")
+
+	syncer, err := NewSyncer(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncer.SetReorgDepth(8)
+	syncAt(t, syncer, source, 13)
+	if len(syncer.undo) == 0 {
+		t.Fatal("undo log is empty after the first sync")
+	}
+
+	// After a quiet period the old events are deeper than the reorg depth below the head
+	syncAt(t, syncer, source, 100)
+	if len(syncer.undo) != 0 {
+		t.Fatalf("undo log has %d entries 87 blocks below the head, want 0", len(syncer.undo))
+	}
+}
+
+func TestSyncerUnknownHashes(t *testing.T) {
+	events := testEvents()
+	source := newChainSource(events)
+
+	syncer, err := NewSyncer(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for head := uint64(11); head <= 13; head++ {
+		syncAt(t, syncer, source, head)
+	}
+	root := syncer.Root()
+
+	// Without the hash of the latest checkpoint, nothing can be decided
+	hash := source.hashes[13]
+	delete(source.hashes, 13)
+	if _, err := syncer.Sync(context.Background()); !errors.Is(err, ErrUnknownBlockHash) {
+		t.Fatalf("Sync error = %v, want ErrUnknownBlockHash", err)
+	}
+	if syncer.Root().Cmp(root) != 0 {
+		t.Fatal("tree changed by a failed reorg check")
+	}
+	source.hashes[13] = hash
+
+	// Block 13 is replaced and the hash of block 12 is unknown: the events are rolled back to
+	// block 11, the newest checkpoint known to be canonical
+	carol := events[4].Account
+	canonical := append(events[:4:4],
+		WeightChangeEvent{Account: carol, PreviousWeight: 0, NewWeight: 9, BlockNumber: 13, LogIndex: 0})
+	source.events = canonical
+	source.hashes[13] = common.HexToHash("0x1300")
+	delete(source.hashes, 12)
+	if applied := syncAt(t, syncer, source, 13); applied != 2 {
+		t.Fatalf("applied %d events after reorg, want 2", applied)
+	}
+	checkReplay(t, syncer, canonical)
+
+	// Whether a reorg reaches a pruned block whose hash is unknown cannot be told
+	source = newChainSource(events)
+	syncer, err = NewSyncer(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncer.SetReorgDepth(1)
+	for head := uint64(10); head <= 13; head++ {
+		syncAt(t, syncer, source, head)
+	}
+	source.hashes[12] = common.HexToHash("0x1200")
+	source.hashes[13] = common.HexToHash("0x1300")
+	delete(source.hashes, 11)
+	if _, err := syncer.Sync(context.Background()); !errors.Is(err, ErrUnknownBlockHash) {
+		t.Fatalf("Sync error = %v, want ErrUnknownBlockHash", err)
+	}
+}
@@ -0,0 +1,113 @@
+package census
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	leanimt "github.com/vocdoni/lean-imt-go"
+)
+
+// Operation is the tree operation performed when replaying a WeightChanged event
+type Operation string
+
+const (
+	OpNone   Operation = ""       // No-op event (both weights are 0)
+	OpInsert Operation = "INSERT" // New leaf appended
+	OpRemove Operation = "REMOVE" // Leaf set to 0, keeping its slot
+	OpUpdate Operation = "UPDATE" // Leaf weight changed in place
+)
+
+// applyEvent replays a single WeightChanged event on the tree, performing the same
+// operation as the contract's _applyDelta, and keeps the account index in sync.
+// It returns the operation and the leaf index.
+func applyEvent(tree *leanimt.LeanIMT[*big.Int], accounts *AccountIndex, event WeightChangeEvent) (Operation, int, error) {
+	prevWeight := event.PreviousWeight
+	newWeight := event.NewWeight
+	accountAddr := event.Account
+
+	// Pack leaves: (address << 88) | weight
+	newLeaf := PackLeaf(accountAddr, newWeight)
+
+	// Determine operation type and execute
+	if prevWeight == 0 && newWeight > 0 {
+		// INSERT: New account getting weight
+		if err := tree.Insert(newLeaf); err != nil {
+			return OpInsert, -1, fmt.Errorf("insert failed: %w", err)
+		}
+		index := tree.Size() - 1
+		accounts.entries[accountAddr] = indexEntry{index: index, weight: newWeight}
+		return OpInsert, index, nil
+
+	} else if newWeight == 0 && prevWeight > 0 {
+		// REMOVE: Account weight going to 0
+		// CRITICAL: tree.Update(index, 0) sets the leaf to 0 but KEEPS the slot
+		// The tree size doesn't decrease - it maintains an empty slot at that index
+		index, ok := lookupWeight(accounts, accountAddr, prevWeight)
+		if !ok {
+			return OpRemove, -1, fmt.Errorf("remove failed: leaf not found for %s", accountAddr.Hex())
+		}
+		if err := tree.Update(index, big.NewInt(0)); err != nil {
+			return OpRemove, index, fmt.Errorf("remove (update to 0) failed: %w", err)
+		}
+		delete(accounts.entries, accountAddr)
+		return OpRemove, index, nil
+
+	} else if prevWeight > 0 && newWeight > 0 {
+		// UPDATE: Weight change (both > 0)
+		index, ok := lookupWeight(accounts, accountAddr, prevWeight)
+		if !ok {
+			return OpUpdate, -1, fmt.Errorf("update failed: leaf not found for %s", accountAddr.Hex())
+		}
+		if err := tree.Update(index, newLeaf); err != nil {
+			return OpUpdate, index, fmt.Errorf("update failed: %w", err)
+		}
+		accounts.entries[accountAddr] = indexEntry{index: index, weight: newWeight}
+		return OpUpdate, index, nil
+	}
+
+	return OpNone, -1, nil
+}
+
+// lookupWeight returns the leaf index of the account if its indexed weight is the expected one
+func lookupWeight(accounts *AccountIndex, account common.Address, weight uint64) (int, bool) {
+	index, current, ok := accounts.Lookup(account)
+	if !ok || current != weight {
+		return -1, false
+	}
+	return index, true
+}
+
+// newTreeFromLeaves builds a tree with exactly the given leaves, including empty (0) slots
+func newTreeFromLeaves(leaves []*big.Int) (*leanimt.LeanIMT[*big.Int], error) {
+	tree, err := leanimt.New(leanimt.PoseidonHasher, leanimt.BigIntEqual, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tree: %w", err)
+	}
+	for i, leaf := range leaves {
+		if leaf.Sign() != 0 {
+			if err := tree.Insert(leaf); err != nil {
+				return nil, fmt.Errorf("failed to insert leaf %d: %w", i, err)
+			}
+			continue
+		}
+		// Empty slots are created the same way replay creates them:
+		// a non-zero leaf is inserted and then updated to 0.
+		if err := tree.Insert(big.NewInt(1)); err != nil {
+			return nil, fmt.Errorf("failed to insert leaf %d: %w", i, err)
+		}
+		if err := tree.Update(i, leaf); err != nil {
+			return nil, fmt.Errorf("failed to empty leaf %d: %w", i, err)
+		}
+	}
+	return tree, nil
+}
+
+// treeRoot returns the tree root, or 0 for an empty tree (as the contract does)
+func treeRoot(tree *leanimt.LeanIMT[*big.Int]) *big.Int {
+	root, exists := tree.Root()
+	if !exists {
+		return big.NewInt(0)
+	}
+	return root
+}
@@ -0,0 +1,160 @@
+package census
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	leanimt "github.com/vocdoni/lean-imt-go"
+)
+
+// snapshotVersion is the current snapshot format version
+const snapshotVersion = 1
+
+// ErrSnapshotRootMismatch is returned when the root stored in a snapshot does not
+// match the root recomputed from its leaves.
+var ErrSnapshotRootMismatch = errors.New("snapshot root does not match its leaves")
+
+// Snapshot is a durable representation of a census tree and of the last event applied to it.
+// Leaves include the empty slots (0) left by removed accounts, so the tree can be rebuilt
+// with exactly the same structure as the contract's.
+type Snapshot struct {
+	Version int            `json:"version"`
+	Root    *hexutil.Big   `json:"root"`
+	Leaves  []*hexutil.Big `json:"leaves"`
+	Cursor  *Cursor        `json:"cursor,omitempty"` // nil if no event was applied
+}
+
+// NewSnapshot captures the current state of the tree. cursor is the position of the last
+// event applied to the tree (nil if none).
+func NewSnapshot(tree *leanimt.LeanIMT[*big.Int], cursor *Cursor) *Snapshot {
+	leaves := tree.Leaves()
+	snapshot := &Snapshot{
+		Version: snapshotVersion,
+		Root:    (*hexutil.Big)(new(big.Int).Set(treeRoot(tree))),
+		Leaves:  make([]*hexutil.Big, len(leaves)),
+	}
+	for i, leaf := range leaves {
+		snapshot.Leaves[i] = (*hexutil.Big)(new(big.Int).Set(leaf))
+	}
+	if cursor != nil {
+		c := *cursor
+		snapshot.Cursor = &c
+	}
+	return snapshot
+}
+
+// Tree rebuilds the tree from the snapshot leaves and verifies that its root matches
+// the stored root. It returns ErrSnapshotRootMismatch otherwise.
+func (s *Snapshot) Tree() (*leanimt.LeanIMT[*big.Int], error) {
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	if s.Root == nil {
+		return nil, fmt.Errorf("snapshot has no root")
+	}
+
+	leaves := make([]*big.Int, len(s.Leaves))
+	for i, leaf := range s.Leaves {
+		if leaf == nil {
+			return nil, fmt.Errorf("snapshot leaf %d is missing", i)
+		}
+		leaves[i] = new(big.Int).Set(leaf.ToInt())
+	}
+	tree, err := newTreeFromLeaves(leaves)
+	if err != nil {
+		return nil, err
+	}
+
+	if root := treeRoot(tree); root.Cmp(s.Root.ToInt()) != 0 {
+		return nil, fmt.Errorf("%w: stored 0x%x, computed 0x%x", ErrSnapshotRootMismatch, s.Root.ToInt(), root)
+	}
+
+	return tree, nil
+}
+
+// SaveSnapshot writes the snapshot to path as JSON. The file is replaced atomically.
+func SaveSnapshot(path string, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot reads a snapshot from path and verifies that its root recomputes from its leaves
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+
+	if _, err := snapshot.Tree(); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// NewSyncerFromSnapshot creates a Syncer resuming from the given snapshot.
+// Only the events recorded after the snapshot cursor are replayed by Sync.
+func NewSyncerFromSnapshot(source IncrementalSource, snapshot *Snapshot) (*Syncer, error) {
+	tree, err := snapshot.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	syncer := &Syncer{
+		source:     source,
+		pageSize:   defaultPageSize,
+		tree:       tree,
+		accounts:   NewAccountIndex(tree),
+		reorgDepth: defaultReorgDepth,
+	}
+	if snapshot.Cursor != nil {
+		cursor := *snapshot.Cursor
+		syncer.cursor = &cursor
+		// The events before the snapshot cannot be rolled back, and the hash of their block
+		// is not known: any reorg reaching past the first Sync is ErrReorgTooDeep
+		syncer.pruned = &BlockRef{Number: cursor.BlockNumber}
+	}
+	return syncer, nil
+}
+
+// Snapshot captures the current tree and cursor of the Syncer
+func (s *Syncer) Snapshot() *Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return NewSnapshot(s.tree, s.cursor)
+}
@@ -0,0 +1,134 @@
+package census
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// sliceSource is an in-memory IncrementalSource
+type sliceSource struct {
+	events []WeightChangeEvent
+}
+
+func (s *sliceSource) GetWeightChangeEventsAfter(_ context.Context, after *Cursor, first int) ([]WeightChangeEvent, error) {
+	var result []WeightChangeEvent
+	for _, e := range s.events {
+		if after == nil || after.Before(e.Cursor()) {
+			result = append(result, e)
+		}
+		if len(result) == first {
+			break
+		}
+	}
+	return result, nil
+}
+
+func testEvents() []WeightChangeEvent {
+	alice := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+	carol := common.HexToAddress("0x00000000000000000000000000000000000ca201")
+	return []WeightChangeEvent{
+		{Account: alice, PreviousWeight: 0, NewWeight: 2, BlockNumber: 10, LogIndex: 0},
+		{Account: bob, PreviousWeight: 0, NewWeight: 1, BlockNumber: 10, LogIndex: 1},
+		{Account: alice, PreviousWeight: 2, NewWeight: 3, BlockNumber: 11, LogIndex: 0},
+		{Account: bob, PreviousWeight: 1, NewWeight: 0, BlockNumber: 12, LogIndex: 4},
+		{Account: carol, PreviousWeight: 0, NewWeight: 5, BlockNumber: 13, LogIndex: 2},
+	}
+}
+
+func TestSnapshotResume(t *testing.T) {
+	ctx := context.Background()
+	events := testEvents()
+
+	// Sync the first four events (the last one leaves an empty slot) and persist them
+	source := &sliceSource{events: events[:4]}
+	syncer, err := NewSyncer(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncer.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "census.json")
+	if err := SaveSnapshot(path, syncer.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(snapshot.Leaves), 2; got != want {
+		t.Fatalf("snapshot has %d leaves, want %d", got, want)
+	}
+	if snapshot.Cursor == nil || *snapshot.Cursor != events[3].Cursor() {
+		t.Fatalf("snapshot cursor = %v, want %v", snapshot.Cursor, events[3].Cursor())
+	}
+
+	// Resume and apply only the remaining event
+	source.events = events
+	resumed, err := NewSyncerFromSnapshot(source, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := resumed.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 1 {
+		t.Fatalf("applied %d events after resume, want 1", applied)
+	}
+
+	// The result must match a full replay
+	full, err := NewSyncer(&sliceSource{events: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := full.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Root().Cmp(full.Root()) != 0 {
+		t.Fatalf("resumed root 0x%x, full replay root 0x%x", resumed.Root(), full.Root())
+	}
+
+	// The account index rebuilt from the snapshot must match the replayed one
+	for _, e := range events {
+		gotIndex, gotWeight, gotOK := resumed.Lookup(e.Account)
+		wantIndex, wantWeight, wantOK := full.Lookup(e.Account)
+		if gotIndex != wantIndex || gotWeight != wantWeight || gotOK != wantOK {
+			t.Fatalf("Lookup(%s) = (%d, %d, %v), want (%d, %d, %v)", e.Account.Hex(),
+				gotIndex, gotWeight, gotOK, wantIndex, wantWeight, wantOK)
+		}
+	}
+	if _, _, ok := full.Lookup(events[3].Account); ok {
+		t.Fatalf("removed account %s is still indexed", events[3].Account.Hex())
+	}
+}
+
+func TestSnapshotRootMismatch(t *testing.T) {
+	syncer, err := NewSyncer(&sliceSource{events: testEvents()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncer.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := syncer.Snapshot()
+	tampered := new(big.Int).Add(snapshot.Root.ToInt(), big.NewInt(1))
+	snapshot.Root.ToInt().Set(tampered)
+
+	path := filepath.Join(t.TempDir(), "census.json")
+	if err := SaveSnapshot(path, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSnapshot(path); !errors.Is(err, ErrSnapshotRootMismatch) {
+		t.Fatalf("LoadSnapshot error = %v, want ErrSnapshotRootMismatch", err)
+	}
+}
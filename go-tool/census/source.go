@@ -0,0 +1,198 @@
+package census
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+)
+
+// WeightChangeEvent is a parsed WeightChanged event, independent of the backend it was read from.
+type WeightChangeEvent struct {
+	Account         common.Address
+	PreviousWeight  uint64
+	NewWeight       uint64
+	BlockNumber     uint64
+	BlockTimestamp  uint64
+	TransactionHash common.Hash
+	LogIndex        uint64
+}
+
+// SubgraphClient is the event source used by TreeReconstructor.
+// Implementations must return events in chronological order (blockNumber ASC, logIndex ASC)
+// and an empty slice once skip is past the last event. Sources that also implement
+// IncrementalSource are paged by cursor instead of skip.
+type SubgraphClient interface {
+	GetWeightChangeEvents(ctx context.Context, first int, skip int) ([]WeightChangeEvent, error)
+}
+
+// Cursor identifies the position of a WeightChanged event in the chain
+type Cursor struct {
+	BlockNumber uint64 `json:"blockNumber"`
+	LogIndex    uint64 `json:"logIndex"`
+}
+
+// Cursor returns the position of the event
+func (e WeightChangeEvent) Cursor() Cursor {
+	return Cursor{BlockNumber: e.BlockNumber, LogIndex: e.LogIndex}
+}
+
+// Before reports whether c is strictly before other in (blockNumber, logIndex) order
+func (c Cursor) Before(other Cursor) bool {
+	if c.BlockNumber != other.BlockNumber {
+		return c.BlockNumber < other.BlockNumber
+	}
+	return c.LogIndex < other.LogIndex
+}
+
+// IncrementalSource is an event source able to return only the events recorded after a
+// known position. It is used by Syncer to keep a tree up to date without full replays.
+//
+// GetWeightChangeEventsAfter returns the events strictly after the given cursor (all events
+// if after is nil) in chronological order. A result shorter than first means that no more
+// events are currently available.
+type IncrementalSource interface {
+	GetWeightChangeEventsAfter(ctx context.Context, after *Cursor, first int) ([]WeightChangeEvent, error)
+}
+
+// ReorgSource is an event source able to tell the canonical hash of past blocks.
+// Syncer uses it to detect chain reorganizations affecting the events it applied, by checking
+// the hashes of the blocks it was pinned to: a block hash vouches for all the events up to it.
+type ReorgSource interface {
+	// BlockHashes returns the current canonical hash of each of the given blocks.
+	// Blocks whose hash is unknown to the source are missing from the result.
+	BlockHashes(ctx context.Context, numbers []uint64) (map[uint64]common.Hash, error)
+}
+
+// BlockRef identifies the block a reconstructed tree corresponds to
+type BlockRef struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// PinnableSource is an event source able to serve a consistent view of the chain at a
+// single block. TreeReconstructor pins such sources before fetching, so that all pages
+// read the same state even if the source keeps indexing new blocks.
+type PinnableSource interface {
+	// PinLatest returns a copy of the source pinned to its latest indexed block, and that block
+	PinLatest(ctx context.Context) (SubgraphClient, BlockRef, error)
+}
+
+// SubgraphAdapter exposes a subgraph.Client as a SubgraphClient
+type SubgraphAdapter struct {
+	client *subgraph.Client
+}
+
+// NewSubgraphAdapter wraps the given subgraph client
+func NewSubgraphAdapter(client *subgraph.Client) *SubgraphAdapter {
+	return &SubgraphAdapter{client: client}
+}
+
+// PinLatest implements PinnableSource. It reads the latest indexed block from the
+// subgraph `_meta` and returns an adapter whose queries are all pinned to it.
+func (a *SubgraphAdapter) PinLatest(ctx context.Context) (SubgraphClient, BlockRef, error) {
+	meta, err := a.client.Meta(ctx)
+	if err != nil {
+		return nil, BlockRef{}, fmt.Errorf("failed to get subgraph block: %w", err)
+	}
+
+	block := BlockRef{Number: meta.Block.Number, Hash: meta.Block.Hash}
+	return NewSubgraphAdapter(a.client.AtBlock(block.Number)), block, nil
+}
+
+// BlockHashes implements ReorgSource with the block hashes known to the subgraph
+func (a *SubgraphAdapter) BlockHashes(ctx context.Context, numbers []uint64) (map[uint64]common.Hash, error) {
+	return a.client.BlockHashes(ctx, numbers)
+}
+
+// GetWeightChangeEvents implements SubgraphClient using skip pagination.
+// TreeReconstructor uses GetWeightChangeEventsAfter instead, which has no skip limit.
+func (a *SubgraphAdapter) GetWeightChangeEvents(ctx context.Context, first int, skip int) ([]WeightChangeEvent, error) {
+	events, err := a.client.GetWeightChangeEvents(ctx, first, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]WeightChangeEvent, 0, len(events))
+	for _, e := range events {
+		event, err := parseSubgraphEvent(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event %s: %w", e.ID, err)
+		}
+		result = append(result, event)
+	}
+
+	return result, nil
+}
+
+// GetWeightChangeEventsAfter implements IncrementalSource using cursor pagination,
+// so it is not subject to the subgraph skip limit.
+func (a *SubgraphAdapter) GetWeightChangeEventsAfter(ctx context.Context, after *Cursor, first int) ([]WeightChangeEvent, error) {
+	if first <= 0 {
+		first = defaultPageSize
+	}
+
+	var cursor *subgraph.EventCursor
+	if after != nil {
+		cursor = &subgraph.EventCursor{BlockNumber: after.BlockNumber, LogIndex: after.LogIndex}
+	}
+
+	events, err := a.client.GetWeightChangeEventsAfter(ctx, cursor, first)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]WeightChangeEvent, 0, len(events))
+	for _, e := range events {
+		event, err := parseSubgraphEvent(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event %s: %w", e.ID, err)
+		}
+		result = append(result, event)
+	}
+
+	return result, nil
+}
+
+// sortEvents sorts events by (blockNumber, logIndex)
+func sortEvents(events []WeightChangeEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Cursor().Before(events[j].Cursor())
+	})
+}
+
+// parseSubgraphEvent converts the raw subgraph representation into a WeightChangeEvent
+func parseSubgraphEvent(e *subgraph.WeightChangeEvent) (WeightChangeEvent, error) {
+	var (
+		event WeightChangeEvent
+		err   error
+	)
+
+	if !common.IsHexAddress(e.Account.ID) {
+		return event, fmt.Errorf("invalid account %q", e.Account.ID)
+	}
+	event.Account = common.HexToAddress(e.Account.ID)
+
+	if event.PreviousWeight, err = strconv.ParseUint(e.PreviousWeight, 10, 64); err != nil {
+		return event, fmt.Errorf("invalid previousWeight: %w", err)
+	}
+	if event.NewWeight, err = strconv.ParseUint(e.NewWeight, 10, 64); err != nil {
+		return event, fmt.Errorf("invalid newWeight: %w", err)
+	}
+	if event.BlockNumber, err = strconv.ParseUint(e.BlockNumber, 10, 64); err != nil {
+		return event, fmt.Errorf("invalid blockNumber: %w", err)
+	}
+	if event.BlockTimestamp, err = strconv.ParseUint(e.BlockTimestamp, 10, 64); err != nil {
+		return event, fmt.Errorf("invalid blockTimestamp: %w", err)
+	}
+	if event.LogIndex, err = strconv.ParseUint(e.LogIndex, 10, 64); err != nil {
+		return event, fmt.Errorf("invalid logIndex: %w", err)
+	}
+	event.TransactionHash = common.HexToHash(e.TransactionHash)
+
+	return event, nil
+}
@@ -0,0 +1,214 @@
+package census
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	leanimt "github.com/vocdoni/lean-imt-go"
+)
+
+// Syncer keeps an in-memory census tree up to date by applying only the
+// WeightChanged events recorded after the last applied one.
+//
+// A Syncer is safe for concurrent use: Sync may run while other goroutines
+// read the root, size or cursor.
+type Syncer struct {
+	source   IncrementalSource
+	pageSize int
+
+	mu       sync.RWMutex
+	tree     *leanimt.LeanIMT[*big.Int]
+	accounts *AccountIndex
+	cursor   *Cursor
+
+	// Undo log of the events applied in the last reorgDepth blocks, and the blocks the
+	// source was pinned to when fetching them (oldest first)
+	undo        []undoEntry
+	checkpoints []BlockRef
+	pruned      *BlockRef // newest checkpoint dropped from the undo log, nil if none
+	reorgDepth  uint64
+}
+
+// NewSyncer creates a Syncer with an empty tree. The first call to Sync replays
+// all events available from the source.
+func NewSyncer(source IncrementalSource) (*Syncer, error) {
+	tree, err := leanimt.New(leanimt.PoseidonHasher, leanimt.BigIntEqual, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tree: %w", err)
+	}
+
+	return &Syncer{
+		source:     source,
+		pageSize:   defaultPageSize,
+		tree:       tree,
+		accounts:   newAccountIndex(),
+		reorgDepth: defaultReorgDepth,
+	}, nil
+}
+
+// Sync fetches the events recorded after the last applied one and applies them to the tree.
+// It returns the number of events applied. If an event fails to apply, the events before it
+// remain applied and the cursor points to the last successful one.
+//
+// A PinnableSource is pinned to its latest block before fetching. If it also implements
+// ReorgSource, the hashes of the blocks pinned by the previous syncs are checked first: events
+// from blocks that are no longer canonical are rolled back and the canonical events are applied
+// in their place. Sync returns ErrReorgTooDeep if the reorg goes past the undo log (see
+// SetReorgDepth).
+func (s *Syncer) Sync(ctx context.Context) (int, error) {
+	if _, err := s.checkReorg(ctx); err != nil {
+		return 0, err
+	}
+
+	source, head, err := s.pin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	applied, err := s.fetchAndApply(ctx, source)
+	if head != nil {
+		s.checkpoint(*head)
+	} else {
+		// Without a pinned block the applied events cannot be checked, nor rolled back
+		s.mu.Lock()
+		s.undo = nil
+		s.mu.Unlock()
+	}
+	return applied, err
+}
+
+// pin returns the source pinned to its latest block and that block, or the source itself
+// and nil if it cannot be pinned. The hash of the block is read before any event is fetched,
+// so a reorg in between is detected by the next Sync instead of being recorded as canonical.
+func (s *Syncer) pin(ctx context.Context) (IncrementalSource, *BlockRef, error) {
+	pinnable, ok := s.source.(PinnableSource)
+	if !ok {
+		return s.source, nil, nil
+	}
+
+	pinned, ref, err := pinnable.PinLatest(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to pin source: %w", err)
+	}
+	source, ok := pinned.(IncrementalSource)
+	if !ok {
+		return nil, nil, fmt.Errorf("pinned source %T does not support cursor pagination", pinned)
+	}
+	if _, ok := s.source.(ReorgSource); ok && ref.Hash == (common.Hash{}) {
+		return nil, nil, fmt.Errorf("source returned no hash for block %d", ref.Number)
+	}
+	return source, &ref, nil
+}
+
+// fetchAndApply applies all the events recorded after the cursor
+func (s *Syncer) fetchAndApply(ctx context.Context, source IncrementalSource) (int, error) {
+	applied := 0
+
+	for {
+		s.mu.RLock()
+		after := s.cursor
+		s.mu.RUnlock()
+
+		events, err := source.GetWeightChangeEventsAfter(ctx, after, s.pageSize)
+		if err != nil {
+			return applied, fmt.Errorf("failed to fetch events: %w", err)
+		}
+
+		n, err := s.apply(events)
+		applied += n
+		if err != nil {
+			return applied, err
+		}
+
+		if len(events) < s.pageSize {
+			return applied, nil
+		}
+	}
+}
+
+// apply replays events on the tree under the write lock, advancing the cursor after each one
+func (s *Syncer) apply(events []WeightChangeEvent) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := 0
+	for _, event := range events {
+		cursor := event.Cursor()
+		if s.cursor != nil && !s.cursor.Before(cursor) {
+			// Already applied (the source returned an overlapping page)
+			continue
+		}
+		op, index, err := applyEvent(s.tree, s.accounts, event)
+		if err != nil {
+			return applied, fmt.Errorf("event at block %d log %d: %w", event.BlockNumber, event.LogIndex, err)
+		}
+		s.record(event, op, index, s.cursor)
+		s.cursor = &cursor
+		applied++
+	}
+
+	return applied, nil
+}
+
+// Run calls Sync every interval until the context is cancelled.
+// Sync errors are passed to onError (if not nil) and do not stop the loop.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sync(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Root returns the current tree root (0 for an empty tree)
+func (s *Syncer) Root() *big.Int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return treeRoot(s.tree)
+}
+
+// Size returns the number of leaves, including empty slots
+func (s *Syncer) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree.Size()
+}
+
+// Cursor returns the position of the last applied event, or nil if none has been applied yet
+func (s *Syncer) Cursor() *Cursor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cursor == nil {
+		return nil
+	}
+	cursor := *s.cursor
+	return &cursor
+}
+
+// Lookup returns the leaf index and current weight of the account in constant time.
+// ok is false if the account has no weight in the tree.
+func (s *Syncer) Lookup(account common.Address) (index int, weight uint64, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.accounts.Lookup(account)
+}
+
+// Tree returns the underlying tree. It must not be used concurrently with Sync.
+func (s *Syncer) Tree() *leanimt.LeanIMT[*big.Int] {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree
+}
@@ -0,0 +1,83 @@
+package census
+
+import (
+	"context"
+	"testing"
+)
+
+// recordingSource is an in-memory source recording the cursors it is queried after
+type recordingSource struct {
+	sliceSource
+	afters []*Cursor
+}
+
+func (s *recordingSource) GetWeightChangeEventsAfter(ctx context.Context, after *Cursor, first int) ([]WeightChangeEvent, error) {
+	s.afters = append(s.afters, after)
+	return s.sliceSource.GetWeightChangeEventsAfter(ctx, after, first)
+}
+
+func (s *recordingSource) GetWeightChangeEvents(_ context.Context, first int, skip int) ([]WeightChangeEvent, error) {
+	if skip >= len(s.events) {
+		return nil, nil
+	}
+	return s.events[skip:min(skip+first, len(s.events))], nil
+}
+
+func TestSyncerIncremental(t *testing.T) {
+	ctx := context.Background()
+	events := testEvents()
+	source := &recordingSource{}
+	syncer, err := NewSyncer(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each step indexes new events; the second one continues the block of the cursor
+	for _, end := range []int{1, 3, 3, 5} {
+		source.events = events[:end]
+		source.afters = nil
+		before := syncer.Cursor()
+
+		applied, err := syncer.Sync(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := end - countUpTo(events, before); applied != want {
+			t.Fatalf("sync up to event %d applied %d events, want %d", end, applied, want)
+		}
+		if len(source.afters) == 0 || !sameCursor(source.afters[0], before) {
+			t.Fatalf("sync up to event %d fetched after %v, want %v", end, source.afters, before)
+		}
+		if cursor, want := syncer.Cursor(), events[end-1].Cursor(); cursor == nil || *cursor != want {
+			t.Fatalf("cursor = %v, want %v", cursor, want)
+		}
+
+		// The tree matches a full reconstruction from the same events
+		tree, root, _, err := NewTreeReconstructor(&recordingSource{sliceSource: sliceSource{events: events[:end]}}).ReconstructTree(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if syncer.Root().Cmp(root) != 0 || syncer.Size() != tree.Size() {
+			t.Fatalf("sync up to event %d: root 0x%x size %d, full reconstruction root 0x%x size %d",
+				end, syncer.Root(), syncer.Size(), root, tree.Size())
+		}
+	}
+}
+
+// countUpTo returns the number of events up to the cursor (inclusive)
+func countUpTo(events []WeightChangeEvent, cursor *Cursor) int {
+	n := 0
+	for _, e := range events {
+		if cursor != nil && !cursor.Before(e.Cursor()) {
+			n++
+		}
+	}
+	return n
+}
+
+func sameCursor(a, b *Cursor) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,58 @@
+package census
+
+import (
+	"math/big"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/common"
+	leanimt "github.com/vocdoni/lean-imt-go"
+)
+
+// VerifyProof checks offline that the leaf (address, weight) is at the given index of the
+// census tree with the given root, reproducing the contract's LeanIMT path computation.
+//
+// LeanIMT proofs only contain the siblings that exist: a node without a right sibling
+// (the last node of its level) is promoted to the next level unchanged. That only happens
+// once the leaf is on the rightmost path of the tree, from some level upwards; below it
+// every level has a sibling. Since each left node on that path is promoted and each right
+// node consumes a sibling, the level where the path joins the rightmost branch is the
+// lowest level l such that l + popcount(index >> l) == len(siblings).
+func VerifyProof(root *big.Int, address common.Address, weight uint64, index int, siblings []*big.Int) bool {
+	if root == nil || index < 0 {
+		return false
+	}
+
+	idx := uint64(index)
+	n := len(siblings)
+
+	// Find the level from which the leaf is on the rightmost path
+	split := -1
+	for level := 0; level <= n; level++ {
+		if level+bits.OnesCount64(idx>>uint(level)) == n {
+			split = level
+			break
+		}
+	}
+	if split < 0 {
+		return false
+	}
+
+	node := PackLeaf(address, weight)
+	used := 0
+	for level := 0; used < n; level++ {
+		switch {
+		case (idx>>uint(level))&1 == 1:
+			// Right node: the sibling is on the left
+			node = leanimt.PoseidonHasher(siblings[used], node)
+			used++
+		case level < split:
+			// Left node with a right sibling
+			node = leanimt.PoseidonHasher(node, siblings[used])
+			used++
+		default:
+			// Left node without a right sibling: promoted unchanged
+		}
+	}
+
+	return node.Cmp(root) == 0
+}
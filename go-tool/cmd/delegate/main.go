@@ -5,6 +5,7 @@ import (
 	"crypto/ecdsa"
 	crand "crypto/rand"
 	"fmt"
+	"math"
 	"math/big"
 	"os"
 	"strings"
@@ -37,6 +38,7 @@ var (
 	privateKeyHex  string
 	alchemyAPIKey  string
 	subgraphURL    string
+	subgraphAPIKey string
 	numDelegates   int
 	collectionIdx  int
 	startTokenID   int
@@ -44,6 +46,7 @@ var (
 	tokensPerTx    int
 	confirmations  int
 	gasMultiplier  float64
+	maxSubgraphLag uint64
 	dryRun         bool
 )
 
@@ -53,6 +56,7 @@ func init() {
 	pflag.StringVar(&privateKeyHex, "private-key", "", "Private key for signing transactions (required)")
 	pflag.StringVar(&alchemyAPIKey, "alchemy-key", "", "Alchemy API key for NFT discovery (optional, enables fast NFT discovery)")
 	pflag.StringVar(&subgraphURL, "subgraph-url", "", "The Graph subgraph endpoint URL (required for V2 contract)")
+	pflag.StringVar(&subgraphAPIKey, "subgraph-api-key", "", "API key sent as a Bearer token to the subgraph endpoint (optional)")
 	pflag.IntVar(&numDelegates, "delegates", 1, "Number of random delegates to create")
 	pflag.IntVar(&collectionIdx, "collection", 0, "Collection index to use (default: 0)")
 	pflag.IntVar(&startTokenID, "start-token", 1, "Starting token ID for sequential mode (default: 1)")
@@ -60,6 +64,7 @@ func init() {
 	pflag.IntVar(&tokensPerTx, "tokens-per-tx", 10, "Number of tokens to delegate per transaction")
 	pflag.IntVar(&confirmations, "confirmations", 1, "Number of block confirmations to wait")
 	pflag.Float64Var(&gasMultiplier, "gas-multiplier", 1.2, "Gas price multiplier for faster transactions")
+	pflag.Uint64Var(&maxSubgraphLag, "max-subgraph-lag", 0, "Fail if the subgraph lags the chain head by more blocks than this (0: only report the lag)")
 	pflag.BoolVar(&dryRun, "dry-run", false, "Simulate without sending transactions")
 }
 
@@ -67,7 +72,7 @@ func main() {
 	pflag.Parse()
 
 	// Print banner
-	fmt.Println(banner)
+	fmt.Print(banner + "\n") // same output as Println, which vet flags for the trailing newline
 
 	// Validate required flags
 	if err := validateFlags(); err != nil {
@@ -120,7 +125,11 @@ func run(ctx context.Context) error {
 	// Initialize subgraph client (required for V2)
 	fmt.Println("🌐 Initializing subgraph client...")
 	fmt.Printf("   URL: %s\n", subgraphURL)
-	sgClient := subgraph.NewClient(subgraphURL)
+	var sgOpts []subgraph.Option
+	if subgraphAPIKey != "" {
+		sgOpts = append(sgOpts, subgraph.WithAPIKey(subgraphAPIKey))
+	}
+	sgClient := subgraph.NewClient(subgraphURL, sgOpts...)
 
 	// Test connection by fetching global stats
 	stats, err := sgClient.GetGlobalStats(ctx)
@@ -146,6 +155,19 @@ func run(ctx context.Context) error {
 	}
 	fmt.Printf("   ✓ Connected to chain ID: %s\n", chainID.String())
 
+	// Delegate weights are read from the subgraph: a stale subgraph would make the
+	// transactions revert with a wrong current weight. Lagging a few blocks is normal, so
+	// the lag is only enforced when --max-subgraph-lag is set.
+	maxLag := maxSubgraphLag
+	if maxLag == 0 {
+		maxLag = math.MaxUint64
+	}
+	status, err := sgClient.CheckSync(ctx, client, maxLag)
+	if err != nil {
+		return fmt.Errorf("subgraph check failed: %w", err)
+	}
+	fmt.Printf("   ✓ Subgraph synced at block %d (%d behind head)\n", status.Meta.Block.Number, status.Lag)
+
 	// Load private key (strip 0x prefix if present)
 	privateKeyClean := strings.TrimPrefix(privateKeyHex, "0x")
 	privateKey, err := crypto.HexToECDSA(privateKeyClean)
@@ -201,7 +223,7 @@ func run(ctx context.Context) error {
 		fmt.Println("   Using Alchemy API for fast NFT discovery...")
 
 		// Get collection address
-		collectionAddr, err := censusContract.Collections(nil, big.NewInt(int64(collectionIdx)))
+		collectionAddr, err := censusContract.Collections(&bind.CallOpts{Context: ctx}, big.NewInt(int64(collectionIdx)))
 		if err != nil {
 			return fmt.Errorf("failed to get collection address: %w", err)
 		}
@@ -212,8 +234,10 @@ func run(ctx context.Context) error {
 			network = "eth-mainnet"
 		}
 
+		alchemy := nft.NewAlchemyClient(alchemyAPIKey, network)
+
 		// Get total count first
-		totalCount, err := nft.GetNFTCountFromAlchemy(alchemyAPIKey, network, fromAddress, collectionAddr)
+		totalCount, err := alchemy.GetNFTCount(ctx, fromAddress, collectionAddr)
 		if err != nil {
 			fmt.Printf("   ⚠️  Alchemy API failed: %v\n", err)
 			fmt.Println("   Falling back to generating sequential token IDs")
@@ -221,14 +245,9 @@ func run(ctx context.Context) error {
 		} else {
 			fmt.Printf("   ✓ Owner has %d NFTs in collection\n", totalCount)
 
-			// Create delegation checker function
-			checkDelegation := func(tokenID *big.Int) (common.Address, error) {
-				return nft.GetTokenDelegation(censusContract, big.NewInt(int64(collectionIdx)), tokenID)
-			}
-
 			// Fetch NFTs with delegation status (stop after finding enough undelegated)
 			requiredNFTs := numDelegates * tokensPerTx
-			allNFTs, err := nft.FetchNFTsFromAlchemy(alchemyAPIKey, network, fromAddress, collectionAddr, checkDelegation, requiredNFTs)
+			allNFTs, err := alchemy.FetchNFTs(ctx, censusContract, big.NewInt(int64(collectionIdx)), collectionAddr, fromAddress, requiredNFTs)
 			if err != nil {
 				fmt.Printf("   ⚠️  Failed to fetch NFTs: %v\n", err)
 				useAlchemy = false
@@ -237,7 +256,6 @@ func run(ctx context.Context) error {
 				undelegatedNFTs = make([]*nft.TokenInfo, 0)
 				for _, token := range allNFTs {
 					if token.DelegatedTo == (common.Address{}) {
-						token.CollectionIndex = big.NewInt(int64(collectionIdx))
 						undelegatedNFTs = append(undelegatedNFTs, token)
 					}
 				}
@@ -284,6 +302,10 @@ func run(ctx context.Context) error {
 			})
 		}
 		fmt.Printf("   ✓ Generated %d sequential token IDs (%d-%d)\n", requiredNFTs, startTokenID, startTokenID+requiredNFTs-1)
+
+		if err := checkGeneratedTokens(ctx, client, censusContract, fromAddress, big.NewInt(int64(collectionIdx)), undelegatedNFTs); err != nil {
+			fmt.Printf("   ⚠️  Could not verify token ownership: %v\n", err)
+		}
 	}
 
 	// Generate random delegate addresses
@@ -319,6 +341,52 @@ func run(ctx context.Context) error {
 	)
 }
 
+// checkGeneratedTokens warns about generated token IDs that are not owned by the sender or
+// already delegated, using batched ownerOf calls and the vectorized getTokenDelegations
+func checkGeneratedTokens(
+	ctx context.Context,
+	client *ethclient.Client,
+	censusContract *census.DavinciDao,
+	owner common.Address,
+	collectionIndex *big.Int,
+	tokens []*nft.TokenInfo,
+) error {
+	collectionAddr, err := censusContract.Collections(&bind.CallOpts{Context: ctx}, collectionIndex)
+	if err != nil {
+		return fmt.Errorf("failed to get collection address: %w", err)
+	}
+
+	tokenIDs := make([]*big.Int, len(tokens))
+	for i, token := range tokens {
+		tokenIDs[i] = token.TokenID
+	}
+	owners, err := nft.NewMulticaller(client).OwnersOf(ctx, collectionAddr, tokenIDs)
+	if err != nil {
+		return err
+	}
+	delegates, err := nft.GetTokenDelegations(ctx, censusContract, collectionIndex, tokenIDs)
+	if err != nil {
+		return err
+	}
+
+	notOwned, delegated := 0, 0
+	for i := range tokens {
+		switch {
+		case owners[i] != owner:
+			notOwned++
+		case delegates[i] != (common.Address{}):
+			delegated++
+		}
+	}
+	if notOwned > 0 || delegated > 0 {
+		fmt.Printf("   ⚠️  %d generated tokens are not owned by %s and %d are already delegated; their delegations will revert\n",
+			notOwned, owner.Hex(), delegated)
+	} else {
+		fmt.Printf("   ✓ All %d tokens are owned and undelegated\n", len(tokens))
+	}
+	return nil
+}
+
 func simulateDelegations(delegates []common.Address, nfts []*nft.TokenInfo) error {
 	nftIndex := 0
 
@@ -354,6 +422,12 @@ func executeDelegations(
 	totalCostWei := big.NewInt(0)
 	nftIndex := 0
 
+	// Query the current weight of all delegates from the subgraph in one request (required for V2)
+	accounts, err := sgClient.GetAccounts(ctx, delegates)
+	if err != nil {
+		return fmt.Errorf("failed to query delegate weights from subgraph: %w", err)
+	}
+
 	// Get initial nonce
 	nonce, err := client.PendingNonceAt(ctx, fromAddress)
 	if err != nil {
@@ -401,17 +475,10 @@ func executeDelegations(
 		fmt.Printf("   Gas price: %s Gwei (multiplier: %.1fx)\n",
 			weiToGwei(auth.GasPrice), gasMultiplier)
 
-		// Query delegate's current weight from subgraph (required for V2)
-		account, err := sgClient.GetAccount(ctx, delegate)
-		if err != nil {
-			return fmt.Errorf("failed to query delegate weight from subgraph: %w", err)
-		}
-
-		var currentWeight uint64 = 0
-		if account != nil {
-			// Parse weight from string
-			fmt.Sscanf(account.Weight, "%d", &currentWeight)
-			fmt.Printf("   ℹ️  Delegate current weight: %d\n", currentWeight)
+		currentWeight := big.NewInt(0)
+		if account := accounts[delegate]; account != nil {
+			currentWeight = account.Weight
+			fmt.Printf("   ℹ️  Delegate current weight: %s\n", currentWeight)
 		} else {
 			fmt.Println("   ℹ️  Delegate current weight: 0 (new delegate)")
 		}
@@ -424,7 +491,7 @@ func executeDelegations(
 			delegate,
 			big.NewInt(int64(collectionIdx)),
 			tokenIDs,
-			big.NewInt(int64(currentWeight)), // Pass current weight for V2 contract
+			currentWeight, // Pass current weight for V2 contract
 			emptyProof,
 		)
 		if err != nil {
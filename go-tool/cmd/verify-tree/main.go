@@ -3,39 +3,49 @@ package main
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"os"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/spf13/pflag"
+	leanimt "github.com/vocdoni/lean-imt-go"
 
 	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
 	censuspkg "github.com/vocdoni/davinci-onchain-census/go-tool/census"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
 )
 
 func main() {
 	var (
 		subgraphURL  string
+		subgraphKey  string
 		rpcURL       string
 		contractAddr string
 		showTree     bool
+		fromBlock    uint64
+		maxLag       uint64
 	)
 
-	pflag.StringVarP(&subgraphURL, "subgraph", "s", "", "The Graph subgraph endpoint URL (required)")
+	pflag.StringVarP(&subgraphURL, "subgraph", "s", "", "The Graph subgraph endpoint URL (if empty, the tree is rebuilt from RPC logs)")
+	pflag.StringVar(&subgraphKey, "subgraph-api-key", "", "API key sent as a Bearer token to the subgraph endpoint (optional)")
 	pflag.StringVarP(&rpcURL, "rpc", "r", "", "Ethereum RPC endpoint URL (required)")
 	pflag.StringVarP(&contractAddr, "contract", "c", "", "DavinciDao contract address (required)")
 	pflag.BoolVarP(&showTree, "show-tree", "t", false, "Show tree structure (all leaves)")
+	pflag.Uint64Var(&fromBlock, "from-block", 0, "Contract deployment block, used when reading RPC logs")
+	pflag.Uint64Var(&maxLag, "max-lag", 10, "Maximum number of blocks the subgraph may lag the chain head")
 	pflag.Parse()
 
 	// Validate required flags
-	if subgraphURL == "" || rpcURL == "" || contractAddr == "" {
-		fmt.Println("Error: --subgraph, --rpc, and --contract flags are required\n")
+	if rpcURL == "" || contractAddr == "" {
+		fmt.Print("Error: --rpc and --contract flags are required\n\n")
 		pflag.Usage()
 		os.Exit(1)
 	}
 
-	if err := verifyTree(subgraphURL, rpcURL, contractAddr, showTree); err != nil {
+	if err := verifyTree(subgraphURL, subgraphKey, rpcURL, contractAddr, fromBlock, maxLag, showTree); err != nil {
 		fmt.Printf("\n❌ Verification failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -43,7 +53,7 @@ func main() {
 	fmt.Println("\n✅ Verification successful!")
 }
 
-func verifyTree(subgraphURL, rpcURL, contractAddr string, showTree bool) error {
+func verifyTree(subgraphURL, subgraphKey, rpcURL, contractAddr string, fromBlock, maxLag uint64, showTree bool) error {
 	ctx := context.Background()
 
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
@@ -77,13 +87,46 @@ func verifyTree(subgraphURL, rpcURL, contractAddr string, showTree bool) error {
 	fmt.Printf("   On-chain root: 0x%x\n", onChainRoot)
 	fmt.Println()
 
-	// Step 2: Reconstruct tree from subgraph
-	fmt.Println("🔄 Reconstructing tree from subgraph...")
-	fmt.Printf("   Subgraph: %s\n", subgraphURL)
-
+	// Step 2: Reconstruct tree from subgraph (or directly from RPC logs)
 	startTime := time.Now()
 
-	tree, reconstructedRoot, err := censuspkg.ReconstructTree(ctx, subgraphURL)
+	var (
+		tree              *leanimt.LeanIMT[*big.Int]
+		reconstructedRoot *big.Int
+		treeBlock         *censuspkg.BlockRef
+		syncErr           error
+	)
+	progress := censuspkg.WithProgress(censuspkg.PrettyProgress(os.Stdout))
+	if subgraphURL != "" {
+		fmt.Println("🔄 Reconstructing tree from subgraph...")
+		fmt.Printf("   Subgraph: %s\n", subgraphURL)
+		var opts []subgraph.Option
+		if subgraphKey != "" {
+			opts = append(opts, subgraph.WithAPIKey(subgraphKey))
+		}
+		sgClient := subgraph.NewClient(subgraphURL, opts...)
+
+		// A stale subgraph yields an old tree, which is not the same as a corrupt one
+		var status *subgraph.SyncStatus
+		status, syncErr = sgClient.CheckSync(ctx, ethClient, maxLag)
+		if status == nil {
+			return syncErr
+		}
+		if syncErr != nil {
+			fmt.Printf("   ⚠️  %v\n", syncErr)
+		} else {
+			fmt.Printf("   ✓ Subgraph synced (block %d, %d behind head)\n", status.Meta.Block.Number, status.Lag)
+		}
+
+		adapter := censuspkg.NewSubgraphAdapter(sgClient)
+		reconstructor := censuspkg.NewTreeReconstructor(adapter, progress)
+		tree, reconstructedRoot, _, err = reconstructor.ReconstructTree(ctx)
+		treeBlock = reconstructor.Block()
+	} else {
+		fmt.Println("🔄 Reconstructing tree from RPC logs...")
+		fmt.Printf("   From block: %d\n", fromBlock)
+		tree, reconstructedRoot, err = censuspkg.ReconstructTreeFromLogs(ctx, ethClient, common.HexToAddress(contractAddr), fromBlock, progress)
+	}
 	if err != nil {
 		return fmt.Errorf("tree reconstruction failed: %w", err)
 	}
@@ -94,6 +137,9 @@ func verifyTree(subgraphURL, rpcURL, contractAddr string, showTree bool) error {
 	fmt.Println("📊 Tree Statistics")
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	fmt.Printf("   Reconstructed root:  0x%x\n", reconstructedRoot)
+	if treeBlock != nil {
+		fmt.Printf("   Subgraph block:      %d\n", treeBlock.Number)
+	}
 	fmt.Printf("   Tree size:           %d leaves\n", tree.Size())
 	fmt.Printf("   Tree depth:          %d levels\n", tree.Depth())
 	fmt.Printf("   Reconstruction time: %v\n", duration)
@@ -121,7 +167,7 @@ func verifyTree(subgraphURL, rpcURL, contractAddr string, showTree bool) error {
 		fmt.Println("   ❌ ROOT MISMATCH!")
 		fmt.Printf("   Expected (on-chain): 0x%x\n", onChainRoot)
 		fmt.Printf("   Got (reconstructed): 0x%x\n", reconstructedRoot)
-		return fmt.Errorf("root validation failed: %w", err)
+		return diagnoseMismatch(ctx, contract, reconstructedRoot, treeBlock, syncErr, err)
 	}
 
 	fmt.Println("   ✅ Root matches perfectly!")
@@ -145,3 +191,32 @@ func verifyTree(subgraphURL, rpcURL, contractAddr string, showTree bool) error {
 
 	return nil
 }
+
+// diagnoseMismatch tells a stale subgraph apart from a corrupt tree when the reconstructed
+// root does not match the current on-chain root
+func diagnoseMismatch(
+	ctx context.Context,
+	contract *census.DavinciDao,
+	reconstructedRoot *big.Int,
+	treeBlock *censuspkg.BlockRef,
+	syncErr error,
+	mismatchErr error,
+) error {
+	// The tree is correct if it matches the on-chain root at the block it was built from
+	if treeBlock != nil {
+		rootAtBlock, err := contract.GetCensusRoot(&bind.CallOpts{
+			Context:     ctx,
+			BlockNumber: new(big.Int).SetUint64(treeBlock.Number),
+		})
+		if err == nil && rootAtBlock.Cmp(reconstructedRoot) == 0 {
+			fmt.Printf("   ℹ️  Reconstructed root matches the on-chain root at block %d\n", treeBlock.Number)
+			return fmt.Errorf("%w: tree is valid at block %d but newer changes are not indexed yet",
+				subgraph.ErrSubgraphStale, treeBlock.Number)
+		}
+	}
+
+	if syncErr != nil {
+		return fmt.Errorf("root validation failed, %w", syncErr)
+	}
+	return fmt.Errorf("root validation failed, reconstructed tree is corrupt: %w", mismatchErr)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+// fakeEth serves the eth_ methods used by verify-tree: the head and getCensusRoot calls
+type fakeEth struct {
+	head uint64
+	root *big.Int
+}
+
+func (f *fakeEth) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(f.head)
+}
+
+func (f *fakeEth) Call(ctx context.Context, msg map[string]any, block any) hexutil.Bytes {
+	return math.U256Bytes(new(big.Int).Set(f.root))
+}
+
+// newRPCServer starts a JSON-RPC endpoint backed by eth
+func newRPCServer(t *testing.T, eth *fakeEth) *httptest.Server {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	return httptest.NewServer(server)
+}
+
+func TestVerifyTreeSubgraphFailure(t *testing.T) {
+	chain := newRPCServer(t, &fakeEth{head: 100, root: big.NewInt(1)})
+	defer chain.Close()
+
+	fake := subgraphtest.NewServer(&subgraphtest.Fixture{Head: 100})
+	defer fake.Close()
+
+	// The subgraph is healthy but every query other than _meta fails
+	target, err := url.Parse(fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !bytes.Contains(body, []byte("_meta")) {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		proxy.ServeHTTP(w, r)
+	}))
+	defer failing.Close()
+
+	err = verifyTree(failing.URL, "", chain.URL, "0x0000000000000000000000000000000000000001", 0, 10, false)
+	if err == nil || !strings.Contains(err.Error(), "tree reconstruction failed") {
+		t.Fatalf("verifyTree error = %v, want a reconstruction failure", err)
+	}
+
+	// A failing _meta query stops verify-tree before reconstruction
+	fake.FailNext(10, http.StatusBadRequest)
+	err = verifyTree(fake.URL, "", chain.URL, "0x0000000000000000000000000000000000000001", 0, 10, false)
+	var statusErr *subgraph.StatusError
+	if err == nil || !errors.As(err, &statusErr) {
+		t.Fatalf("verifyTree error = %v, want a status error", err)
+	}
+}
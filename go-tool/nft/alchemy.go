@@ -1,14 +1,30 @@
 package nft
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math/big"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+)
+
+const (
+	// alchemyPageSize is the number of NFTs requested per getNFTsForOwner page (the API maximum)
+	alchemyPageSize = 100
+	// defaultAlchemyTimeout is the timeout of each request of the default HTTP client
+	defaultAlchemyTimeout = 30 * time.Second
+	// defaultAlchemyRetries is the number of times a rate limited or failed request is retried
+	defaultAlchemyRetries = 3
+	// defaultAlchemyRetryDelay is the delay before the first retry, doubled on each retry
+	defaultAlchemyRetryDelay = time.Second
 )
 
 // AlchemyNFTResponse represents the response from Alchemy's getNFTsForOwner API
@@ -26,85 +42,162 @@ type AlchemyNFT struct {
 	TokenID string `json:"tokenId"`
 }
 
-// FetchNFTsFromAlchemy fetches NFTs owned by an address using Alchemy API
-// If maxUndelegated > 0, stops after finding that many undelegated tokens
-func FetchNFTsFromAlchemy(
-	apiKey string,
-	network string,
+// AlchemyClient queries the Alchemy NFT API
+type AlchemyClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	retryDelay time.Duration
+}
+
+// NewAlchemyClient creates a client for the given Alchemy network (e.g. eth-mainnet, eth-sepolia)
+func NewAlchemyClient(apiKey string, network string) *AlchemyClient {
+	return &AlchemyClient{
+		apiKey:     apiKey,
+		baseURL:    fmt.Sprintf("https://%s.g.alchemy.com", network),
+		httpClient: &http.Client{Timeout: defaultAlchemyTimeout},
+		maxRetries: defaultAlchemyRetries,
+		retryDelay: defaultAlchemyRetryDelay,
+	}
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (c *AlchemyClient) SetHTTPClient(httpClient *http.Client) {
+	if httpClient != nil {
+		c.httpClient = httpClient
+	}
+}
+
+// SetBaseURL sets the API base URL, e.g. to point the client at a local server in tests
+func (c *AlchemyClient) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetRetry sets how rate limited (429) and failed (5xx) requests are retried: up to maxRetries
+// times, waiting the Retry-After delay or else baseDelay doubled on each retry. Use maxRetries 0
+// to disable retries.
+func (c *AlchemyClient) SetRetry(maxRetries int, baseDelay time.Duration) {
+	c.maxRetries = maxRetries
+	c.retryDelay = baseDelay
+}
+
+// GetNFTsForOwner fetches a page of the NFTs of a collection owned by the address.
+// pageKey is empty for the first page, then the PageKey of the previous response.
+func (c *AlchemyClient) GetNFTsForOwner(
+	ctx context.Context,
 	owner common.Address,
 	contractAddress common.Address,
-	checkDelegation func(tokenID *big.Int) (common.Address, error),
+	pageKey string,
+	pageSize int,
+) (*AlchemyNFTResponse, error) {
+	reqURL, err := url.Parse(fmt.Sprintf("%s/nft/v3/%s/getNFTsForOwner", c.baseURL, c.apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := reqURL.Query()
+	q.Add("owner", owner.Hex())
+	q.Add("contractAddresses[]", contractAddress.Hex())
+	q.Add("pageSize", strconv.Itoa(pageSize))
+	q.Add("withMetadata", "false")
+	if pageKey != "" {
+		q.Add("pageKey", pageKey)
+	}
+	reqURL.RawQuery = q.Encode()
+
+	body, err := c.get(ctx, reqURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var alchemyResp AlchemyNFTResponse
+	if err := json.Unmarshal(body, &alchemyResp); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return &alchemyResp, nil
+}
+
+// GetNFTCount gets the number of NFTs of a collection owned by the address, without fetching them all
+func (c *AlchemyClient) GetNFTCount(ctx context.Context, owner common.Address, contractAddress common.Address) (int, error) {
+	resp, err := c.GetNFTsForOwner(ctx, owner, contractAddress, "", 1) // Just get the first item to get totalCount
+	if err != nil {
+		return 0, err
+	}
+	return resp.TotalCount, nil
+}
+
+// FetchNFTs fetches the NFTs of a collection owned by the address, with their current delegate.
+// Delegations are checked once per page with the vectorized getTokenDelegations.
+// If maxUndelegated > 0, stops after finding that many undelegated tokens.
+func (c *AlchemyClient) FetchNFTs(
+	ctx context.Context,
+	censusContract *census.DavinciDao,
+	collectionIndex *big.Int,
+	collectionAddr common.Address,
+	owner common.Address,
 	maxUndelegated int,
 ) ([]*TokenInfo, error) {
-	baseURL := fmt.Sprintf("https://%s.g.alchemy.com/nft/v3/%s/getNFTsForOwner", network, apiKey)
+	delegations := func(ctx context.Context, tokenIDs []*big.Int) ([]common.Address, error) {
+		return GetTokenDelegations(ctx, censusContract, collectionIndex, tokenIDs)
+	}
+	nfts, err := c.fetchNFTs(ctx, owner, collectionAddr, delegations, maxUndelegated)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range nfts {
+		token.CollectionIndex = collectionIndex
+	}
+	return nfts, nil
+}
 
+// fetchNFTs pages through getNFTsForOwner, looking up the delegates of each page at once
+// if delegations is not nil
+func (c *AlchemyClient) fetchNFTs(
+	ctx context.Context,
+	owner common.Address,
+	contractAddress common.Address,
+	delegations func(ctx context.Context, tokenIDs []*big.Int) ([]common.Address, error),
+	maxUndelegated int,
+) ([]*TokenInfo, error) {
 	allNFTs := make([]*TokenInfo, 0)
 	undelegatedCount := 0
 	pageKey := ""
 
 	for {
-		// Build URL with parameters
-		reqURL, err := url.Parse(baseURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse URL: %w", err)
-		}
-
-		q := reqURL.Query()
-		q.Add("owner", owner.Hex())
-		q.Add("contractAddresses[]", contractAddress.Hex())
-		q.Add("pageSize", "100")
-		q.Add("withMetadata", "false")
-
-		if pageKey != "" {
-			q.Add("pageKey", pageKey)
-		}
-
-		reqURL.RawQuery = q.Encode()
-
-		// Make HTTP request
-		resp, err := http.Get(reqURL.String())
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch from Alchemy: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return nil, fmt.Errorf("Alchemy API error (status %d): %s", resp.StatusCode, string(body))
-		}
-
-		// Parse response
-		body, err := io.ReadAll(resp.Body)
+		page, err := c.GetNFTsForOwner(ctx, owner, contractAddress, pageKey, alchemyPageSize)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
+			return nil, err
 		}
 
-		var alchemyResp AlchemyNFTResponse
-		if err := json.Unmarshal(body, &alchemyResp); err != nil {
-			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		tokenIDs := make([]*big.Int, len(page.OwnedNfts))
+		for i, nft := range page.OwnedNfts {
+			tokenID, ok := new(big.Int).SetString(nft.TokenID, 0) // Auto-detect base (hex or decimal)
+			if !ok {
+				return nil, fmt.Errorf("invalid token ID %q", nft.TokenID)
+			}
+			tokenIDs[i] = tokenID
 		}
 
-		// Convert to TokenInfo and check delegation status
-		for _, nft := range alchemyResp.OwnedNfts {
-			tokenID := new(big.Int)
-			tokenID.SetString(nft.TokenID, 0) // Auto-detect base (hex or decimal)
-
-			// Check if token is already delegated
-			var delegatedTo common.Address
-			if checkDelegation != nil {
-				delegatedTo, _ = checkDelegation(tokenID)
-				if delegatedTo == (common.Address{}) {
-					undelegatedCount++
-				}
+		delegates := make([]common.Address, len(tokenIDs))
+		if delegations != nil && len(tokenIDs) > 0 {
+			delegates, err = delegations(ctx, tokenIDs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check delegations: %w", err)
 			}
+		}
 
+		for i, nft := range page.OwnedNfts {
 			allNFTs = append(allNFTs, &TokenInfo{
 				CollectionIndex: big.NewInt(0), // Will be set by caller
 				CollectionAddr:  common.HexToAddress(nft.Contract.Address),
-				TokenID:         tokenID,
-				DelegatedTo:     delegatedTo,
+				TokenID:         tokenIDs[i],
+				DelegatedTo:     delegates[i],
 			})
 
+			if delegations != nil && delegates[i] == (common.Address{}) {
+				undelegatedCount++
+			}
 			// Early exit if we have enough undelegated tokens
 			if maxUndelegated > 0 && undelegatedCount >= maxUndelegated {
 				return allNFTs, nil
@@ -112,56 +205,89 @@ func FetchNFTsFromAlchemy(
 		}
 
 		// Check if there are more pages
-		if alchemyResp.PageKey == "" {
+		if page.PageKey == "" {
 			break
 		}
-		pageKey = alchemyResp.PageKey
+		pageKey = page.PageKey
 	}
 
 	return allNFTs, nil
 }
 
-// GetNFTCountFromAlchemy gets just the total count without fetching all NFTs
-func GetNFTCountFromAlchemy(
-	apiKey string,
-	network string,
-	owner common.Address,
-	contractAddress common.Address,
-) (int, error) {
-	baseURL := fmt.Sprintf("https://%s.g.alchemy.com/nft/v3/%s/getNFTsForOwner", network, apiKey)
-
-	reqURL, err := url.Parse(baseURL)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse URL: %w", err)
-	}
-
-	q := reqURL.Query()
-	q.Add("owner", owner.Hex())
-	q.Add("contractAddresses[]", contractAddress.Hex())
-	q.Add("pageSize", "1") // Just get the first item to get totalCount
-	q.Add("withMetadata", "false")
-	reqURL.RawQuery = q.Encode()
+// get sends a GET request and returns the response body, retrying rate limited and failed requests
+func (c *AlchemyClient) get(ctx context.Context, reqURL string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
 
-	resp, err := http.Get(reqURL.String())
-	if err != nil {
-		return 0, fmt.Errorf("failed to fetch from Alchemy: %w", err)
-	}
-	defer resp.Body.Close()
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch from Alchemy: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("Alchemy API error (status %d): %s", resp.StatusCode, string(body))
-	}
+		if resp.StatusCode == http.StatusOK {
+			return body, nil
+		}
+		retriable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		if !retriable || attempt >= c.maxRetries {
+			return nil, fmt.Errorf("Alchemy API error (status %d): %s", resp.StatusCode, string(body))
+		}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read response: %w", err)
+		delay := c.retryDelay << attempt
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
 	}
+}
 
-	var alchemyResp AlchemyNFTResponse
-	if err := json.Unmarshal(body, &alchemyResp); err != nil {
-		return 0, fmt.Errorf("failed to parse JSON: %w", err)
+// FetchNFTsFromAlchemy fetches NFTs owned by an address using Alchemy API
+// If maxUndelegated > 0, stops after finding that many undelegated tokens
+//
+// Deprecated: Use NewAlchemyClient and AlchemyClient.FetchNFTs, which take a context and
+// check the delegations of a whole page at once.
+func FetchNFTsFromAlchemy(
+	apiKey string,
+	network string,
+	owner common.Address,
+	contractAddress common.Address,
+	checkDelegation func(tokenID *big.Int) (common.Address, error),
+	maxUndelegated int,
+) ([]*TokenInfo, error) {
+	var delegations func(ctx context.Context, tokenIDs []*big.Int) ([]common.Address, error)
+	if checkDelegation != nil {
+		delegations = func(_ context.Context, tokenIDs []*big.Int) ([]common.Address, error) {
+			delegates := make([]common.Address, len(tokenIDs))
+			for i, tokenID := range tokenIDs {
+				delegates[i], _ = checkDelegation(tokenID)
+			}
+			return delegates, nil
+		}
 	}
+	return NewAlchemyClient(apiKey, network).fetchNFTs(context.Background(), owner, contractAddress, delegations, maxUndelegated)
+}
 
-	return alchemyResp.TotalCount, nil
+// GetNFTCountFromAlchemy gets just the total count without fetching all NFTs
+//
+// Deprecated: Use NewAlchemyClient and AlchemyClient.GetNFTCount.
+func GetNFTCountFromAlchemy(
+	apiKey string,
+	network string,
+	owner common.Address,
+	contractAddress common.Address,
+) (int, error) {
+	return NewAlchemyClient(apiKey, network).GetNFTCount(context.Background(), owner, contractAddress)
 }
@@ -0,0 +1,196 @@
+package nft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// alchemyPages serves getNFTsForOwner pages of token IDs, keyed by pageKey
+func alchemyPages(t *testing.T, owner, collection common.Address, pages [][]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if !strings.HasSuffix(r.URL.Path, "/nft/v3/key/getNFTsForOwner") ||
+			q.Get("owner") != owner.Hex() || q.Get("contractAddresses[]") != collection.Hex() {
+			t.Errorf("unexpected request %s", r.URL)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		page := 0
+		if key := q.Get("pageKey"); key != "" {
+			fmt.Sscanf(key, "page-%d", &page)
+		}
+		var resp AlchemyNFTResponse
+		for _, p := range pages {
+			resp.TotalCount += len(p)
+		}
+		for _, id := range pages[page] {
+			nft := AlchemyNFT{TokenID: id}
+			nft.Contract.Address = collection.Hex()
+			resp.OwnedNfts = append(resp.OwnedNfts, nft)
+		}
+		if page+1 < len(pages) {
+			resp.PageKey = fmt.Sprintf("page-%d", page+1)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func newTestAlchemyClient(url string) *AlchemyClient {
+	client := NewAlchemyClient("key", "eth-mainnet")
+	client.SetBaseURL(url)
+	client.SetRetry(3, time.Millisecond)
+	return client
+}
+
+func TestAlchemyFetchNFTs(t *testing.T) {
+	ctx := context.Background()
+	pages := [][]string{{"1", "0x2"}, {"3"}, {"4", "5"}}
+	server := httptest.NewServer(alchemyPages(t, alice, collectionA, pages))
+	defer server.Close()
+	client := newTestAlchemyClient(server.URL)
+
+	// Delegations are looked up once per page; token 3 is delegated to bob
+	var lookups [][]int64
+	delegations := func(_ context.Context, tokenIDs []*big.Int) ([]common.Address, error) {
+		var ids []int64
+		delegates := make([]common.Address, len(tokenIDs))
+		for i, tokenID := range tokenIDs {
+			ids = append(ids, tokenID.Int64())
+			if tokenID.Int64() == 3 {
+				delegates[i] = bob
+			}
+		}
+		lookups = append(lookups, ids)
+		return delegates, nil
+	}
+
+	nfts, err := client.fetchNFTs(ctx, alice, collectionA, delegations, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nfts) != 5 {
+		t.Fatalf("fetched %d NFTs, want 5", len(nfts))
+	}
+	for i, token := range nfts {
+		if token.TokenID.Int64() != int64(i+1) || token.CollectionAddr != collectionA {
+			t.Fatalf("NFT %d = %s/%s, want token %d", i, token.CollectionAddr.Hex(), token.TokenID, i+1)
+		}
+		if delegated := token.DelegatedTo == bob; delegated != (i == 2) {
+			t.Fatalf("token %d delegated to %s", i+1, token.DelegatedTo.Hex())
+		}
+	}
+	if got := fmt.Sprint(lookups); got != "[[1 2] [3] [4 5]]" {
+		t.Fatalf("delegation lookups %s, want one per page", got)
+	}
+
+	// Paging stops once enough undelegated tokens are found
+	lookups = nil
+	nfts, err = client.fetchNFTs(ctx, alice, collectionA, delegations, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nfts) != 2 || len(lookups) != 1 {
+		t.Fatalf("fetched %d NFTs in %d pages, want 2 in 1", len(nfts), len(lookups))
+	}
+
+	if count, err := client.GetNFTCount(ctx, alice, collectionA); err != nil || count != 5 {
+		t.Fatalf("GetNFTCount = (%d, %v), want (5, nil)", count, err)
+	}
+}
+
+func TestAlchemyInvalidTokenID(t *testing.T) {
+	server := httptest.NewServer(alchemyPages(t, alice, collectionA, [][]string{{"1", "x"}}))
+	defer server.Close()
+
+	_, err := newTestAlchemyClient(server.URL).fetchNFTs(context.Background(), alice, collectionA, nil, 0)
+	if err == nil || !strings.Contains(err.Error(), `invalid token ID "x"`) {
+		t.Fatalf("error = %v, want invalid token ID", err)
+	}
+}
+
+func TestAlchemyRetry(t *testing.T) {
+	ctx := context.Background()
+	pages := alchemyPages(t, alice, collectionA, [][]string{{"1"}})
+
+	// Rate limited and failed requests are retried, honoring Retry-After
+	var requests atomic.Int32
+	statuses := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			if n == 1 {
+				w.Header().Set("Retry-After", "1")
+			}
+			http.Error(w, "try again", statuses[n-1])
+			return
+		}
+		pages(w, r)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	nfts, err := newTestAlchemyClient(server.URL).fetchNFTs(ctx, alice, collectionA, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nfts) != 1 || requests.Load() != 3 {
+		t.Fatalf("fetched %d NFTs in %d requests, want 1 in 3", len(nfts), requests.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %s, want the 1s Retry-After delay", elapsed)
+	}
+
+	// Retries are bounded, and client errors are not retried
+	for _, tc := range []struct {
+		status   int
+		requests int32
+	}{
+		{http.StatusInternalServerError, 4},
+		{http.StatusBadRequest, 1},
+	} {
+		requests.Store(0)
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			http.Error(w, "failed", tc.status)
+		}))
+		_, err := newTestAlchemyClient(failing.URL).GetNFTCount(ctx, alice, collectionA)
+		failing.Close()
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("status %d", tc.status)) {
+			t.Fatalf("status %d: error = %v", tc.status, err)
+		}
+		if requests.Load() != tc.requests {
+			t.Fatalf("status %d: sent %d requests, want %d", tc.status, requests.Load(), tc.requests)
+		}
+	}
+}
+
+func TestAlchemyContextCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := newTestAlchemyClient(server.URL).fetchNFTs(ctx, alice, collectionA, nil, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancelled request returned after %s", elapsed)
+	}
+}
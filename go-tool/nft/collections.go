@@ -0,0 +1,167 @@
+package nft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+)
+
+// maxCollections bounds the collection count search, far above any real deployment
+const maxCollections = 1 << 20
+
+// erc721MetadataABI is the optional ERC-721 metadata extension
+const erc721MetadataABI = `[{"inputs":[],"name":"name","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"symbol","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"}]`
+
+var erc721Metadata = mustParseABI(erc721MetadataABI)
+
+// Collection is an NFT collection registered in the census contract
+type Collection struct {
+	Index   *big.Int
+	Address common.Address
+	Name    string // empty if the collection does not implement the metadata extension
+	Symbol  string
+}
+
+// GetCollectionCount returns the number of collections registered in the census contract.
+// The `collections` getter reverts past the end of the array, so the length is found with
+// an exponential then binary search. Errors other than reverts are returned, instead of
+// being mistaken for the end of the array.
+func GetCollectionCount(ctx context.Context, contract *census.DavinciDao) (int, error) {
+	opts := &bind.CallOpts{Context: ctx}
+	exists := func(index int) (bool, error) {
+		_, err := contract.Collections(opts, big.NewInt(int64(index)))
+		if err == nil {
+			return true, nil
+		}
+		if isRevert(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get collection %d: %w", index, err)
+	}
+
+	// Find an index past the end: collections[low] exists and collections[high] does not
+	found, err := exists(0)
+	if err != nil || !found {
+		return 0, err
+	}
+	low, high := 0, 1
+	for {
+		found, err := exists(high)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			break
+		}
+		if high >= maxCollections {
+			return 0, fmt.Errorf("more than %d collections", maxCollections)
+		}
+		low, high = high, high*2
+	}
+
+	for high-low > 1 {
+		mid := low + (high-low)/2
+		found, err := exists(mid)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return high, nil
+}
+
+// GetCollectionAddresses returns the address of every collection registered in the census
+// contract, by collection index
+func GetCollectionAddresses(ctx context.Context, contract *census.DavinciDao) ([]common.Address, error) {
+	count, err := GetCollectionCount(ctx, contract)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection count: %w", err)
+	}
+
+	addresses := make([]common.Address, count)
+	for i := range addresses {
+		addresses[i], err = contract.Collections(&bind.CallOpts{Context: ctx}, big.NewInt(int64(i)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get collection %d: %w", i, err)
+		}
+	}
+	return addresses, nil
+}
+
+// GetCollections returns the collections registered in the census contract, with their
+// ERC-721 name and symbol where the collection provides them
+func GetCollections(
+	ctx context.Context,
+	client bind.ContractCaller,
+	contract *census.DavinciDao,
+) ([]*Collection, error) {
+	addresses, err := GetCollectionAddresses(ctx, contract)
+	if err != nil {
+		return nil, err
+	}
+
+	nameCall, err := erc721Metadata.Pack("name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack name: %w", err)
+	}
+	symbolCall, err := erc721Metadata.Pack("symbol")
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack symbol: %w", err)
+	}
+	calls := make([]Call, 0, 2*len(addresses))
+	for _, address := range addresses {
+		calls = append(calls,
+			Call{Target: address, Data: nameCall},
+			Call{Target: address, Data: symbolCall},
+		)
+	}
+	results, err := NewMulticaller(client).Aggregate(ctx, calls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection metadata: %w", err)
+	}
+
+	collections := make([]*Collection, len(addresses))
+	for i, address := range addresses {
+		collections[i] = &Collection{
+			Index:   big.NewInt(int64(i)),
+			Address: address,
+			Name:    unpackString("name", results[2*i]),
+			Symbol:  unpackString("symbol", results[2*i+1]),
+		}
+	}
+	return collections, nil
+}
+
+// unpackString decodes the result of a string metadata call, empty if it failed
+func unpackString(method string, result CallResult) string {
+	if !result.Success {
+		return ""
+	}
+	out, err := erc721Metadata.Unpack(method, result.ReturnData)
+	if err != nil || len(out) != 1 {
+		return ""
+	}
+	s, _ := out[0].(string)
+	return s
+}
+
+// isRevert reports whether a call error is a revert returned by the node, as opposed to a
+// transport or node error (geth reports reverts with code 3, other clients with the message)
+func isRevert(err error) bool {
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	return rpcErr.ErrorCode() == 3 || strings.Contains(rpcErr.Error(), "revert")
+}
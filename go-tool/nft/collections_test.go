@@ -0,0 +1,87 @@
+package nft
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+)
+
+var errConnectionReset = errors.New("connection reset by peer")
+
+// collectionsChain serves count collections, failing the lookup of failIndex with a
+// transport error, and records the indexes looked up
+type collectionsChain struct {
+	*nftChain
+	failIndex int64
+	lookups   []int64
+}
+
+func newCollectionsChain(count int) *collectionsChain {
+	chain := &collectionsChain{nftChain: &nftChain{}, failIndex: -1}
+	for i := 0; i < count; i++ {
+		chain.collections = append(chain.collections, &testCollection{address: common.BigToAddress(big.NewInt(int64(i + 1)))})
+	}
+	return chain
+}
+
+func (c *collectionsChain) CallContract(ctx context.Context, call ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if method, err := davinciDaoABI.MethodById(call.Data[:4]); err == nil && method.Name == "collections" {
+		args, err := method.Inputs.Unpack(call.Data[4:])
+		if err != nil {
+			return nil, err
+		}
+		index := args[0].(*big.Int).Int64()
+		c.lookups = append(c.lookups, index)
+		if index == c.failIndex {
+			return nil, errConnectionReset
+		}
+	}
+	return c.nftChain.CallContract(ctx, call, block)
+}
+
+func TestGetCollectionCount(t *testing.T) {
+	for _, count := range []int{0, 1, 2, 3, 4, 5, 7, 8, 9, 31, 32, 33, 1023, 1024, 1025} {
+		chain := newCollectionsChain(count)
+		contract, err := census.NewDavinciDao(censusAddress, chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := GetCollectionCount(context.Background(), contract)
+		if err != nil {
+			t.Fatalf("count %d: %v", count, err)
+		}
+		if got != count {
+			t.Fatalf("GetCollectionCount = %d, want %d", got, count)
+		}
+		// Logarithmic: the exponential then the binary search
+		if limit := 2*big.NewInt(int64(count)).BitLen() + 2; len(chain.lookups) > limit {
+			t.Fatalf("count %d took %d lookups, want at most %d", count, len(chain.lookups), limit)
+		}
+	}
+}
+
+func TestGetCollectionCountRPCError(t *testing.T) {
+	// Indexes 64 and 128 are probed by the exponential search, 96 and 112 by the binary search
+	for _, failIndex := range []int64{0, 64, 128, 96, 112} {
+		chain := newCollectionsChain(100)
+		chain.failIndex = failIndex
+		contract, err := census.NewDavinciDao(censusAddress, chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := GetCollectionCount(context.Background(), contract)
+		if !errors.Is(err, errConnectionReset) {
+			t.Fatalf("failing index %d: GetCollectionCount = %d, %v, want the RPC error", failIndex, count, err)
+		}
+		if chain.lookups[len(chain.lookups)-1] != failIndex {
+			t.Fatalf("failing index %d: search went on to index %d", failIndex, chain.lookups[len(chain.lookups)-1])
+		}
+	}
+}
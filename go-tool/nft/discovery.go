@@ -2,8 +2,10 @@ package nft
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -12,6 +14,9 @@ import (
 	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/erc721"
 )
 
+// scanChunkSize is the number of token IDs whose owner is looked up at once when scanning
+const scanChunkSize = 10000
+
 // TokenInfo represents information about an NFT
 type TokenInfo struct {
 	CollectionIndex *big.Int
@@ -20,37 +25,66 @@ type TokenInfo struct {
 	DelegatedTo     common.Address
 }
 
-// DiscoverOwnedNFTs discovers all NFTs owned by the given address across all collections
+// errNotEnumerable is returned by discoverFromCollection for collections without
+// ERC721Enumerable support
+var errNotEnumerable = errors.New("collection does not support enumeration")
+
+// NotEnumerableError is returned by DiscoverOwnedNFTs, along with the tokens found in the
+// other collections, when the owner holds tokens of collections that do not implement
+// ERC721Enumerable. Their tokens can be found with an OwnershipIndex (see
+// DiscoverOwnedNFTsFromLogs).
+type NotEnumerableError struct {
+	Collections []*Collection
+}
+
+func (e *NotEnumerableError) Error() string {
+	addresses := make([]string, len(e.Collections))
+	for i, collection := range e.Collections {
+		addresses[i] = collection.Address.Hex()
+	}
+	return fmt.Sprintf("%d collections do not support enumeration: %s", len(e.Collections), strings.Join(addresses, ", "))
+}
+
+// DiscoverOwnedNFTs discovers all NFTs owned by the given address across all collections,
+// with their current delegate. Collections must implement ERC721Enumerable: if the owner holds
+// tokens of other collections, the tokens found are returned with a *NotEnumerableError.
+// Collections that fail otherwise are reported and skipped.
 func DiscoverOwnedNFTs(
 	ctx context.Context,
+	client bind.ContractBackend,
 	censusContract *census.DavinciDao,
 	owner common.Address,
 ) ([]*TokenInfo, error) {
 	fmt.Printf("🔍 Discovering NFTs owned by %s...\n", owner.Hex())
 
 	allNFTs := make([]*TokenInfo, 0)
+	multicaller := NewMulticaller(client)
+	var notEnumerable []*Collection
 
-	// Get number of collections
-	collectionCount, err := getCollectionCount(censusContract)
+	collections, err := GetCollections(ctx, client, censusContract)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get collection count: %w", err)
+		return nil, fmt.Errorf("failed to get collections: %w", err)
 	}
 
-	fmt.Printf("   Found %d collections\n", collectionCount)
+	fmt.Printf("   Found %d collections\n", len(collections))
 
 	// Iterate through each collection
-	for i := 0; i < collectionCount; i++ {
-		collectionAddr, err := censusContract.Collections(nil, big.NewInt(int64(i)))
-		if err != nil {
-			return nil, fmt.Errorf("failed to get collection %d: %w", i, err)
+	for _, collection := range collections {
+		if collection.Name != "" {
+			fmt.Printf("   📦 Collection %s: %s (%s, %s)\n", collection.Index, collection.Address.Hex(), collection.Name, collection.Symbol)
+		} else {
+			fmt.Printf("   📦 Collection %s: %s\n", collection.Index, collection.Address.Hex())
 		}
 
-		fmt.Printf("   📦 Collection %d: %s\n", i, collectionAddr.Hex())
-
 		// Get NFTs from this collection
-		nfts, err := discoverFromCollection(ctx, collectionAddr, owner, big.NewInt(int64(i)))
+		nfts, err := discoverFromCollection(ctx, client, multicaller, censusContract, collection.Address, owner, collection.Index)
+		if errors.Is(err, errNotEnumerable) {
+			fmt.Printf("      ⚠️  Warning: collection %s does not support enumeration, use an ownership index\n", collection.Index)
+			notEnumerable = append(notEnumerable, collection)
+			continue
+		}
 		if err != nil {
-			fmt.Printf("      ⚠️  Warning: failed to discover NFTs from collection %d: %v\n", i, err)
+			fmt.Printf("      ⚠️  Warning: failed to discover NFTs from collection %s: %v\n", collection.Index, err)
 			continue
 		}
 
@@ -59,55 +93,95 @@ func DiscoverOwnedNFTs(
 	}
 
 	fmt.Printf("   ✓ Total NFTs discovered: %d\n", len(allNFTs))
-	return allNFTs, nil
-}
-
-// getCollectionCount attempts to determine the number of collections
-func getCollectionCount(contract *census.DavinciDao) (int, error) {
-	count := 0
-	for i := 0; i < 100; i++ { // Reasonable upper limit
-		_, err := contract.Collections(nil, big.NewInt(int64(i)))
-		if err != nil {
-			// Failed to get collection, assume we've reached the end
-			break
-		}
-		count++
+	if len(notEnumerable) > 0 {
+		return allNFTs, &NotEnumerableError{Collections: notEnumerable}
 	}
-	return count, nil
+	return allNFTs, nil
 }
 
-// discoverFromCollection discovers NFTs from a specific collection
+// discoverFromCollection discovers the NFTs owned in a specific collection
 func discoverFromCollection(
 	ctx context.Context,
+	client bind.ContractBackend,
+	multicaller *Multicaller,
+	censusContract *census.DavinciDao,
 	collectionAddr common.Address,
 	owner common.Address,
 	collectionIndex *big.Int,
 ) ([]*TokenInfo, error) {
-	// Try ERC721Enumerable first
-	nfts, err := tryEnumerableDiscovery(collectionAddr, owner, collectionIndex)
-	if err == nil && len(nfts) > 0 {
-		return nfts, nil
+	opts := &bind.CallOpts{Context: ctx}
+
+	nftContract, err := erc721.NewERC721(collectionAddr, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ERC721 contract: %w", err)
 	}
 
-	// Fallback: manual scanning (less efficient)
-	// This would require more sophisticated logic or external indexing
-	return []*TokenInfo{}, fmt.Errorf("collection does not support enumeration, manual discovery required")
+	balance, err := nftContract.BalanceOf(opts, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get NFT balance: %w", err)
+	}
+	if balance.Sign() == 0 {
+		return []*TokenInfo{}, nil
+	}
+
+	// Only ERC721Enumerable collections can list the tokens of an owner. Contracts without
+	// ERC-165 revert on supportsInterface.
+	supportsEnumerable, err := checkEnumerableSupport(opts, nftContract)
+	if err != nil && !isRevert(err) {
+		return nil, fmt.Errorf("failed to check enumeration support: %w", err)
+	}
+	if !supportsEnumerable {
+		return nil, errNotEnumerable
+	}
+
+	return tryEnumerableDiscovery(ctx, multicaller, censusContract, owner, collectionAddr, collectionIndex, balance)
 }
 
-// tryEnumerableDiscovery tries to discover NFTs using ERC721Enumerable
+// tryEnumerableDiscovery lists the tokens of the owner with tokenOfOwnerByIndex and
+// looks up their current delegate, both in batches
 func tryEnumerableDiscovery(
-	collectionAddr common.Address,
+	ctx context.Context,
+	multicaller *Multicaller,
+	censusContract *census.DavinciDao,
 	owner common.Address,
+	collectionAddr common.Address,
 	collectionIndex *big.Int,
+	balance *big.Int,
 ) ([]*TokenInfo, error) {
-	// Note: This is a placeholder. In a real implementation, we would:
-	// 1. Connect to the ERC721 contract
-	// 2. Call balanceOf(owner)
-	// 3. Loop through tokenOfOwnerByIndex(owner, i) for i in [0, balance)
-	// 4. For each token, check delegation status
-
-	// For now, return empty as this requires the eth client to be passed through
-	return []*TokenInfo{}, fmt.Errorf("enumerable discovery not implemented in this simplified version")
+	tokenIDs, err := multicaller.TokensOfOwner(ctx, collectionAddr, owner, balance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list owned tokens: %w", err)
+	}
+	if missing := balance.Int64() - int64(len(tokenIDs)); missing > 0 {
+		fmt.Printf("      ⚠️  Failed to get %d of %s tokens\n", missing, balance.String())
+	}
+
+	return withDelegations(ctx, censusContract, collectionAddr, collectionIndex, tokenIDs)
+}
+
+// withDelegations builds the TokenInfo of the tokens of a collection, with their current delegate
+func withDelegations(
+	ctx context.Context,
+	censusContract *census.DavinciDao,
+	collectionAddr common.Address,
+	collectionIndex *big.Int,
+	tokenIDs []*big.Int,
+) ([]*TokenInfo, error) {
+	delegates, err := GetTokenDelegations(ctx, censusContract, collectionIndex, tokenIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	nfts := make([]*TokenInfo, len(tokenIDs))
+	for i, tokenID := range tokenIDs {
+		nfts[i] = &TokenInfo{
+			CollectionIndex: collectionIndex,
+			CollectionAddr:  collectionAddr,
+			TokenID:         tokenID,
+			DelegatedTo:     delegates[i],
+		}
+	}
+	return nfts, nil
 }
 
 // DiscoverUndelegatedNFTs finds NFTs owned by the address that are not yet delegated
@@ -124,7 +198,7 @@ func DiscoverUndelegatedNFTs(
 	undelegated := make([]*TokenInfo, 0)
 
 	// Get collection address
-	collectionAddr, err := censusContract.Collections(nil, collectionIndex)
+	collectionAddr, err := censusContract.Collections(&bind.CallOpts{Context: ctx}, collectionIndex)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get collection address: %w", err)
 	}
@@ -136,7 +210,8 @@ func DiscoverUndelegatedNFTs(
 	}
 
 	// Try to get balance first
-	balance, err := nftContract.BalanceOf(nil, owner)
+	opts := &bind.CallOpts{Context: ctx}
+	balance, err := nftContract.BalanceOf(opts, owner)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get NFT balance: %w", err)
 	}
@@ -148,130 +223,120 @@ func DiscoverUndelegatedNFTs(
 	}
 
 	// Try enumerable interface first
-	supportsEnumerable, err := checkEnumerableSupport(nftContract)
+	multicaller := NewMulticaller(client)
+	supportsEnumerable, err := checkEnumerableSupport(opts, nftContract)
 	if err == nil && supportsEnumerable {
 		fmt.Println("   ✓ Collection supports ERC721Enumerable")
-		return discoverViaEnumerable(nftContract, censusContract, owner, collectionAddr, collectionIndex, balance)
+		return discoverViaEnumerable(ctx, multicaller, censusContract, owner, collectionAddr, collectionIndex, balance)
 	}
 
 	// Fallback to scanning
 	fmt.Println("   ℹ️  Using scan method (collection doesn't support enumerable)")
-	return scanForOwnedTokens(nftContract, censusContract, owner, collectionAddr, collectionIndex, maxTokenID)
+	return scanForOwnedTokens(ctx, multicaller, censusContract, owner, collectionAddr, collectionIndex, maxTokenID)
 }
 
 // checkEnumerableSupport checks if contract supports ERC721Enumerable
-func checkEnumerableSupport(contract *erc721.ERC721) (bool, error) {
+func checkEnumerableSupport(opts *bind.CallOpts, contract *erc721.ERC721) (bool, error) {
 	// ERC721Enumerable interface ID: 0x780e9d63
 	interfaceID := [4]byte{0x78, 0x0e, 0x9d, 0x63}
-	return contract.SupportsInterface(nil, interfaceID)
+	return contract.SupportsInterface(opts, interfaceID)
 }
 
 // discoverViaEnumerable uses tokenOfOwnerByIndex to find NFTs
 func discoverViaEnumerable(
-	nftContract *erc721.ERC721,
+	ctx context.Context,
+	multicaller *Multicaller,
 	censusContract *census.DavinciDao,
 	owner common.Address,
 	collectionAddr common.Address,
 	collectionIndex *big.Int,
 	balance *big.Int,
 ) ([]*TokenInfo, error) {
-	undelegated := make([]*TokenInfo, 0)
-
-	balanceInt := balance.Int64()
-	for i := int64(0); i < balanceInt; i++ {
-		tokenID, err := nftContract.TokenOfOwnerByIndex(nil, owner, big.NewInt(i))
-		if err != nil {
-			fmt.Printf("      ⚠️  Failed to get token at index %d: %v\n", i, err)
-			continue
-		}
-
-		// Check if token is delegated
-		delegatedTo, err := getTokenDelegation(censusContract, collectionIndex, tokenID)
-		if err != nil {
-			fmt.Printf("      ⚠️  Failed to check delegation for token %s: %v\n", tokenID.String(), err)
-			continue
-		}
-
-		if delegatedTo == (common.Address{}) {
-			undelegated = append(undelegated, &TokenInfo{
-				CollectionIndex: collectionIndex,
-				CollectionAddr:  collectionAddr,
-				TokenID:         tokenID,
-				DelegatedTo:     delegatedTo,
-			})
-		}
-
-		if (i+1)%10 == 0 {
-			fmt.Printf("      ... checked %d/%d tokens\n", i+1, balanceInt)
-		}
+	nfts, err := tryEnumerableDiscovery(ctx, multicaller, censusContract, owner, collectionAddr, collectionIndex, balance)
+	if err != nil {
+		return nil, err
 	}
 
+	undelegated := filterUndelegated(nfts)
 	fmt.Printf("   ✓ Found %d undelegated NFTs\n", len(undelegated))
 	return undelegated, nil
 }
 
-// scanForOwnedTokens scans token IDs to find owned tokens
+// scanForOwnedTokens scans token IDs to find owned tokens, with batched ownerOf calls
 func scanForOwnedTokens(
-	nftContract *erc721.ERC721,
+	ctx context.Context,
+	multicaller *Multicaller,
 	censusContract *census.DavinciDao,
 	owner common.Address,
 	collectionAddr common.Address,
 	collectionIndex *big.Int,
 	maxTokenID int64,
 ) ([]*TokenInfo, error) {
-	undelegated := make([]*TokenInfo, 0)
-
+	if maxTokenID < 0 {
+		return nil, fmt.Errorf("invalid max token ID %d", maxTokenID)
+	}
 	fmt.Printf("   Scanning token IDs 0-%d...\n", maxTokenID)
 
-	for tokenID := int64(0); tokenID <= maxTokenID; tokenID++ {
-		tokenIDBig := big.NewInt(tokenID)
-
-		// Check ownership
-		tokenOwner, err := nftContract.OwnerOf(nil, tokenIDBig)
-		if err != nil {
-			// Token doesn't exist or error, skip
-			continue
+	// Candidates are looked up a chunk at a time, so memory does not grow with maxTokenID
+	owned := make([]*big.Int, 0)
+	for start := int64(0); ; start += scanChunkSize {
+		end := maxTokenID
+		if maxTokenID-start >= scanChunkSize {
+			end = start + scanChunkSize - 1
 		}
-
-		if tokenOwner != owner {
-			continue
+		candidates := make([]*big.Int, 0, end-start+1)
+		for tokenID := start; tokenID <= end; tokenID++ {
+			candidates = append(candidates, big.NewInt(tokenID))
 		}
 
-		// Check if delegated
-		delegatedTo, err := getTokenDelegation(censusContract, collectionIndex, tokenIDBig)
+		// Tokens that do not exist have no owner
+		owners, err := multicaller.OwnersOf(ctx, collectionAddr, candidates)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to get token owners: %w", err)
 		}
-
-		if delegatedTo == (common.Address{}) {
-			undelegated = append(undelegated, &TokenInfo{
-				CollectionIndex: collectionIndex,
-				CollectionAddr:  collectionAddr,
-				TokenID:         tokenIDBig,
-				DelegatedTo:     delegatedTo,
-			})
+		for i, tokenOwner := range owners {
+			if tokenOwner == owner {
+				owned = append(owned, candidates[i])
+			}
 		}
-
-		if (tokenID+1)%100 == 0 {
-			fmt.Printf("      ... scanned %d tokens, found %d owned\n", tokenID+1, len(undelegated))
+		if end == maxTokenID {
+			break
 		}
 	}
 
-	fmt.Printf("   ✓ Scan complete: found %d undelegated NFTs\n", len(undelegated))
+	nfts, err := withDelegations(ctx, censusContract, collectionAddr, collectionIndex, owned)
+	if err != nil {
+		return nil, err
+	}
+
+	undelegated := filterUndelegated(nfts)
+	fmt.Printf("   ✓ Scan complete: found %d owned, %d undelegated NFTs\n", len(owned), len(undelegated))
 	return undelegated, nil
 }
 
+// filterUndelegated returns the tokens that are not delegated
+func filterUndelegated(nfts []*TokenInfo) []*TokenInfo {
+	undelegated := make([]*TokenInfo, 0, len(nfts))
+	for _, token := range nfts {
+		if token.DelegatedTo == (common.Address{}) {
+			undelegated = append(undelegated, token)
+		}
+	}
+	return undelegated
+}
+
 // GetTokenDelegation checks if a token is delegated
 func GetTokenDelegation(
 	contract *census.DavinciDao,
 	collectionIndex *big.Int,
 	tokenID *big.Int,
 ) (common.Address, error) {
-	return getTokenDelegation(contract, collectionIndex, tokenID)
+	return getTokenDelegation(nil, contract, collectionIndex, tokenID)
 }
 
 // getTokenDelegation checks if a token is delegated
 func getTokenDelegation(
+	opts *bind.CallOpts,
 	contract *census.DavinciDao,
 	collectionIndex *big.Int,
 	tokenID *big.Int,
@@ -289,7 +354,7 @@ func getTokenDelegation(
 	key := crypto.Keccak256Hash(packed)
 
 	// Call tokenDelegate mapping
-	delegatedTo, err := contract.TokenDelegate(nil, key)
+	delegatedTo, err := contract.TokenDelegate(opts, key)
 	if err != nil {
 		return common.Address{}, err
 	}
@@ -0,0 +1,169 @@
+package nft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+)
+
+var (
+	censusAddress = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	davinciDaoABI = mustParseABI(census.DavinciDaoABI)
+)
+
+// testCollection is an ERC-721 collection served by nftChain
+type testCollection struct {
+	address    common.Address
+	enumerable bool
+	tokens     map[common.Address][]int64 // owner → token IDs, in enumeration order
+}
+
+// nftChain is a bind.ContractBackend serving the census contract at censusAddress, its
+// collections and a Multicall3 deployment. Other backend methods are not implemented.
+type nftChain struct {
+	bind.ContractBackend
+
+	collections []*testCollection
+	delegates   map[string]common.Address // "collectionIndex-tokenID" → delegate
+}
+
+func (c *nftChain) CodeAt(context.Context, common.Address, *big.Int) ([]byte, error) {
+	return []byte{0x60}, nil
+}
+
+func (c *nftChain) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	if *call.To != Multicall3Address {
+		return c.call(*call.To, call.Data)
+	}
+
+	method := multicall3.Methods["aggregate3"]
+	args, err := method.Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	calls := *abi.ConvertType(args[0], new([]call3)).(*[]call3)
+	results := make([]CallResult, len(calls))
+	for i, sub := range calls {
+		output, err := c.call(sub.Target, sub.CallData)
+		results[i] = CallResult{Success: err == nil, ReturnData: output}
+	}
+	return method.Outputs.Pack(results)
+}
+
+// call runs a call to the census contract or a collection
+func (c *nftChain) call(to common.Address, data []byte) ([]byte, error) {
+	contractABI := erc721ABI
+	if to == censusAddress {
+		contractABI = davinciDaoABI
+	}
+	method, err := contractABI.MethodById(data[:4])
+	if err != nil {
+		return nil, revertError{}
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	if to == censusAddress {
+		switch method.Name {
+		case "collections":
+			index := args[0].(*big.Int).Int64()
+			if index >= int64(len(c.collections)) {
+				return nil, revertError{}
+			}
+			return method.Outputs.Pack(c.collections[index].address)
+		case "getTokenDelegations":
+			delegates := make([]common.Address, 0)
+			for _, tokenID := range args[1].([]*big.Int) {
+				delegates = append(delegates, c.delegates[fmt.Sprintf("%s-%s", args[0], tokenID)])
+			}
+			return method.Outputs.Pack(delegates)
+		}
+		return nil, revertError{}
+	}
+
+	var collection *testCollection
+	for _, candidate := range c.collections {
+		if candidate.address == to {
+			collection = candidate
+		}
+	}
+	if collection == nil {
+		return nil, revertError{}
+	}
+	switch method.Name {
+	case "supportsInterface":
+		return method.Outputs.Pack(collection.enumerable && args[0].([4]byte) == [4]byte{0x78, 0x0e, 0x9d, 0x63})
+	case "balanceOf":
+		return method.Outputs.Pack(big.NewInt(int64(len(collection.tokens[args[0].(common.Address)]))))
+	case "tokenOfOwnerByIndex":
+		tokens := collection.tokens[args[0].(common.Address)]
+		index := args[1].(*big.Int).Int64()
+		if !collection.enumerable || index >= int64(len(tokens)) {
+			return nil, revertError{}
+		}
+		return method.Outputs.Pack(big.NewInt(tokens[index]))
+	}
+	return nil, revertError{}
+}
+
+func TestDiscoverOwnedNFTs(t *testing.T) {
+	ctx := context.Background()
+	collectionC := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	chain := &nftChain{
+		collections: []*testCollection{
+			{address: collectionA, enumerable: true, tokens: map[common.Address][]int64{alice: {7, 3, 12}, bob: {1}}},
+			{address: collectionB, enumerable: false, tokens: map[common.Address][]int64{alice: {5}}},
+			{address: collectionC, enumerable: false, tokens: map[common.Address][]int64{bob: {2}}},
+		},
+		delegates: map[string]common.Address{"0-3": bob, "0-12": alice},
+	}
+	contract, err := census.NewDavinciDao(censusAddress, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tokens of the enumerable collection are listed; alice also holds tokens of a
+	// collection that cannot be enumerated, but not of the other one
+	nfts, err := DiscoverOwnedNFTs(ctx, chain, contract, alice)
+	var notEnumerable *NotEnumerableError
+	if !errors.As(err, &notEnumerable) {
+		t.Fatalf("DiscoverOwnedNFTs error = %v, want a NotEnumerableError", err)
+	}
+	if len(notEnumerable.Collections) != 1 || notEnumerable.Collections[0].Address != collectionB {
+		t.Fatalf("collections not enumerated: %+v", notEnumerable.Collections)
+	}
+
+	want := []struct {
+		tokenID  int64
+		delegate common.Address
+	}{{7, common.Address{}}, {3, bob}, {12, alice}}
+	if len(nfts) != len(want) {
+		t.Fatalf("discovered %d tokens, want %d", len(nfts), len(want))
+	}
+	for i, nft := range nfts {
+		if nft.CollectionAddr != collectionA || nft.CollectionIndex.Int64() != 0 ||
+			nft.TokenID.Int64() != want[i].tokenID || nft.DelegatedTo != want[i].delegate {
+			t.Fatalf("token %d = %+v, want ID %d delegated to %s", i, nft, want[i].tokenID, want[i].delegate.Hex())
+		}
+	}
+
+	// Without tokens of non-enumerable collections, discovery succeeds
+	chain.collections[1].tokens = nil
+	nfts, err = DiscoverOwnedNFTs(ctx, chain, contract, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nfts) != len(want) {
+		t.Fatalf("discovered %d tokens, want %d", len(nfts), len(want))
+	}
+}
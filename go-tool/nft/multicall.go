@@ -0,0 +1,282 @@
+package nft
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/erc721"
+)
+
+// Multicall3Address is the address Multicall3 is deployed at on most EVM chains
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+const (
+	// defaultMulticallBatchSize is the number of calls aggregated per eth_call
+	defaultMulticallBatchSize = 500
+	// delegationBatchSize is the number of token IDs per getTokenDelegations call
+	delegationBatchSize = 1000
+)
+
+// multicall3ABI is the aggregate3 function of Multicall3
+const multicall3ABI = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+var (
+	multicall3 = mustParseABI(multicall3ABI)
+	erc721ABI  = mustParseABI(erc721.ERC721ABI)
+)
+
+// Call is a contract call to aggregate
+type Call struct {
+	Target common.Address
+	Data   []byte
+}
+
+// CallResult is the result of an aggregated call. Success is false if the call reverted.
+type CallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// Multicaller aggregates read-only contract calls, so that hundreds of lookups take a
+// handful of requests. Calls are sent through Multicall3 aggregate3, allowing each call
+// to fail on its own. On chains without Multicall3 they are sent one by one.
+//
+// A Multicaller is safe for concurrent use.
+type Multicaller struct {
+	caller    bind.ContractCaller
+	batchSize int
+
+	mu       sync.Mutex
+	address  common.Address
+	deployed *bool // whether Multicall3 has code, checked on first use
+}
+
+// call3 is an aggregate3 call
+type call3 struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// NewMulticaller creates a Multicaller using the Multicall3 deployment at Multicall3Address
+func NewMulticaller(caller bind.ContractCaller) *Multicaller {
+	return &Multicaller{
+		caller:    caller,
+		address:   Multicall3Address,
+		batchSize: defaultMulticallBatchSize,
+	}
+}
+
+// SetAddress sets the Multicall3 address, for chains where it is not deployed at the usual address
+func (m *Multicaller) SetAddress(address common.Address) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.address = address
+	m.deployed = nil
+}
+
+// SetBatchSize sets the number of calls aggregated per eth_call
+func (m *Multicaller) SetBatchSize(calls int) {
+	if calls > 0 {
+		m.batchSize = calls
+	}
+}
+
+// Aggregate executes the calls and returns their results in the same order. A call that
+// reverts only fails its own result; transport errors fail the whole batch.
+func (m *Multicaller) Aggregate(ctx context.Context, calls []Call) ([]CallResult, error) {
+	address, deployed, err := m.deployment(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]CallResult, 0, len(calls))
+	for start := 0; start < len(calls); start += m.batchSize {
+		end := min(start+m.batchSize, len(calls))
+
+		var (
+			batch []CallResult
+			err   error
+		)
+		if deployed {
+			batch, err = m.aggregate3(ctx, address, calls[start:end])
+		} else {
+			batch, err = m.sequential(ctx, calls[start:end])
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batch...)
+	}
+	return results, nil
+}
+
+// deployment returns the Multicall3 address and whether it has code, checking it on first use
+func (m *Multicaller) deployment(ctx context.Context) (common.Address, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.deployed == nil {
+		code, err := m.caller.CodeAt(ctx, m.address, nil)
+		if err != nil {
+			return common.Address{}, false, fmt.Errorf("failed to check Multicall3 deployment: %w", err)
+		}
+		deployed := len(code) > 0
+		m.deployed = &deployed
+	}
+	return m.address, *m.deployed, nil
+}
+
+// aggregate3 executes a batch of calls in a single eth_call to the Multicall3 at address
+func (m *Multicaller) aggregate3(ctx context.Context, address common.Address, calls []Call) ([]CallResult, error) {
+	args := make([]call3, len(calls))
+	for i, call := range calls {
+		args[i] = call3{Target: call.Target, AllowFailure: true, CallData: call.Data}
+	}
+	input, err := multicall3.Pack("aggregate3", args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack aggregate3: %w", err)
+	}
+
+	output, err := m.caller.CallContract(ctx, ethereum.CallMsg{To: &address, Data: input}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call aggregate3: %w", err)
+	}
+
+	var results []CallResult
+	if err := multicall3.UnpackIntoInterface(&results, "aggregate3", output); err != nil {
+		return nil, fmt.Errorf("failed to unpack aggregate3: %w", err)
+	}
+	if len(results) != len(calls) {
+		return nil, fmt.Errorf("aggregate3 returned %d results for %d calls", len(results), len(calls))
+	}
+	return results, nil
+}
+
+// sequential executes a batch of calls one by one. Reverts fail only their call, other
+// errors fail the batch.
+func (m *Multicaller) sequential(ctx context.Context, calls []Call) ([]CallResult, error) {
+	results := make([]CallResult, len(calls))
+	for i, call := range calls {
+		output, err := m.caller.CallContract(ctx, ethereum.CallMsg{To: &call.Target, Data: call.Data}, nil)
+		if err != nil {
+			if isRevert(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to call %s: %w", call.Target.Hex(), err)
+		}
+		results[i] = CallResult{Success: true, ReturnData: output}
+	}
+	return results, nil
+}
+
+// OwnersOf returns the owner of each token of the collection, in the same order.
+// Tokens whose ownerOf call fails (e.g. not minted or burned) have the zero address.
+func (m *Multicaller) OwnersOf(ctx context.Context, collection common.Address, tokenIDs []*big.Int) ([]common.Address, error) {
+	calls := make([]Call, len(tokenIDs))
+	for i, tokenID := range tokenIDs {
+		data, err := erc721ABI.Pack("ownerOf", tokenID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pack ownerOf: %w", err)
+		}
+		calls[i] = Call{Target: collection, Data: data}
+	}
+
+	results, err := m.Aggregate(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make([]common.Address, len(results))
+	for i, result := range results {
+		if !result.Success {
+			continue
+		}
+		out, err := erc721ABI.Unpack("ownerOf", result.ReturnData)
+		if err != nil || len(out) != 1 {
+			continue
+		}
+		owners[i], _ = out[0].(common.Address)
+	}
+	return owners, nil
+}
+
+// TokensOfOwner returns the tokens of the owner in an ERC721Enumerable collection, reading
+// tokenOfOwnerByIndex for every index below balance. Indexes whose call fails are skipped.
+func (m *Multicaller) TokensOfOwner(
+	ctx context.Context,
+	collection common.Address,
+	owner common.Address,
+	balance *big.Int,
+) ([]*big.Int, error) {
+	calls := make([]Call, 0, balance.Int64())
+	for i := int64(0); i < balance.Int64(); i++ {
+		data, err := erc721ABI.Pack("tokenOfOwnerByIndex", owner, big.NewInt(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to pack tokenOfOwnerByIndex: %w", err)
+		}
+		calls = append(calls, Call{Target: collection, Data: data})
+	}
+
+	results, err := m.Aggregate(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenIDs := make([]*big.Int, 0, len(results))
+	for _, result := range results {
+		if !result.Success {
+			continue
+		}
+		out, err := erc721ABI.Unpack("tokenOfOwnerByIndex", result.ReturnData)
+		if err != nil || len(out) != 1 {
+			continue
+		}
+		if tokenID, ok := out[0].(*big.Int); ok {
+			tokenIDs = append(tokenIDs, tokenID)
+		}
+	}
+	return tokenIDs, nil
+}
+
+// GetTokenDelegations returns the current delegate of each token of a collection (zero
+// address if undelegated), in the same order, using the contract's vectorized
+// getTokenDelegations (one call per 1000 tokens)
+func GetTokenDelegations(
+	ctx context.Context,
+	contract *census.DavinciDao,
+	collectionIndex *big.Int,
+	tokenIDs []*big.Int,
+) ([]common.Address, error) {
+	delegates := make([]common.Address, 0, len(tokenIDs))
+	for start := 0; start < len(tokenIDs); start += delegationBatchSize {
+		end := min(start+delegationBatchSize, len(tokenIDs))
+
+		batch, err := contract.GetTokenDelegations(&bind.CallOpts{Context: ctx}, collectionIndex, tokenIDs[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token delegations: %w", err)
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("getTokenDelegations returned %d delegates for %d tokens", len(batch), end-start)
+		}
+		delegates = append(delegates, batch...)
+	}
+	return delegates, nil
+}
+
+// mustParseABI parses a constant ABI definition
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(fmt.Sprintf("invalid ABI: %v", err))
+	}
+	return parsed
+}
@@ -0,0 +1,146 @@
+package nft
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// revertError is the JSON-RPC error of a reverted eth_call
+type revertError struct{}
+
+func (revertError) Error() string  { return "execution reverted" }
+func (revertError) ErrorCode() int { return 3 }
+
+// ownerChain is a bind.ContractCaller serving ownerOf for a collection, directly or through
+// a Multicall3 deployed at Multicall3Address
+type ownerChain struct {
+	owners map[int64]common.Address // token ID → owner, other tokens revert
+
+	mu     sync.Mutex
+	codeAt int
+}
+
+func (c *ownerChain) CodeAt(_ context.Context, contract common.Address, _ *big.Int) ([]byte, error) {
+	c.mu.Lock()
+	c.codeAt++
+	c.mu.Unlock()
+	if contract == Multicall3Address {
+		return []byte{0x60}, nil
+	}
+	return nil, nil
+}
+
+func (c *ownerChain) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	if *call.To != Multicall3Address {
+		return c.ownerOf(call.Data)
+	}
+
+	method := multicall3.Methods["aggregate3"]
+	args, err := method.Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	calls := *abi.ConvertType(args[0], new([]call3)).(*[]call3)
+	results := make([]CallResult, len(calls))
+	for i, sub := range calls {
+		output, err := c.ownerOf(sub.CallData)
+		results[i] = CallResult{Success: err == nil, ReturnData: output}
+	}
+	return method.Outputs.Pack(results)
+}
+
+func (c *ownerChain) ownerOf(data []byte) ([]byte, error) {
+	method := erc721ABI.Methods["ownerOf"]
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	owner, ok := c.owners[args[0].(*big.Int).Int64()]
+	if !ok {
+		return nil, revertError{}
+	}
+	return method.Outputs.Pack(owner)
+}
+
+func TestMulticallerConcurrent(t *testing.T) {
+	ctx := context.Background()
+	chain := &ownerChain{owners: map[int64]common.Address{1: alice, 2: bob, 4: alice}}
+	multicaller := NewMulticaller(chain)
+	multicaller.SetBatchSize(2)
+
+	tokenIDs := []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3), big.NewInt(4)}
+	want := []common.Address{alice, bob, {}, alice}
+
+	// Lookups run while the Multicall3 address switches between a deployment and an
+	// address without code, which falls back to one call per token
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%4 == 0 {
+				address := Multicall3Address
+				if i%8 == 0 {
+					address = common.HexToAddress("0x1")
+				}
+				multicaller.SetAddress(address)
+				return
+			}
+			owners, err := multicaller.OwnersOf(ctx, collectionA, tokenIDs)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for j := range want {
+				if owners[j] != want[j] {
+					errs <- errors.New("wrong owner of token " + tokenIDs[j].String() + ": " + owners[j].Hex())
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// The deployment is checked once per address
+	chain.codeAt = 0
+	multicaller.SetAddress(Multicall3Address)
+	for i := 0; i < 3; i++ {
+		if _, err := multicaller.OwnersOf(ctx, collectionA, tokenIDs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if chain.codeAt != 1 {
+		t.Fatalf("Multicall3 deployment checked %d times, want 1", chain.codeAt)
+	}
+}
+
+func TestScanForOwnedTokens(t *testing.T) {
+	ctx := context.Background()
+	chain := &ownerChain{owners: map[int64]common.Address{0: bob, scanChunkSize: bob}}
+	multicaller := NewMulticaller(chain)
+
+	if _, err := scanForOwnedTokens(ctx, multicaller, nil, alice, collectionA, big.NewInt(0), -1); err == nil {
+		t.Fatal("scan with a negative max token ID succeeded")
+	}
+
+	// The last token ID starts a new chunk; alice owns none, so no delegation is looked up
+	nfts, err := scanForOwnedTokens(ctx, multicaller, nil, alice, collectionA, big.NewInt(0), scanChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nfts) != 0 {
+		t.Fatalf("scan found %d tokens of alice, want 0", len(nfts))
+	}
+}
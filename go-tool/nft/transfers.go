@@ -0,0 +1,419 @@
+package nft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/bindings/go/census"
+)
+
+// defaultTransferChunkSize is the block range requested per eth_getLogs call
+const defaultTransferChunkSize = 5000
+
+// defaultConfirmations is the number of blocks behind the head the index stops at: 64 blocks
+// (two epochs) is when mainnet blocks are finalized
+const defaultConfirmations = 64
+
+// ownershipIndexVersion is the current format version of saved ownership indexes
+const ownershipIndexVersion = 1
+
+// transferTopic is the topic of Transfer(address,address,uint256). ERC-721 indexes the
+// token ID (4 topics), which tells its logs apart from ERC-20 transfers (3 topics).
+var transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// TransferBackend is the RPC functionality needed to scan Transfer logs (satisfied by *ethclient.Client)
+type TransferBackend interface {
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// OwnershipIndex is an owner → tokens index of NFT collections built from their ERC-721
+// Transfer logs, so that collections without ERC721Enumerable can be searched without
+// calling ownerOf for every token ID.
+//
+// Update only scans the blocks after the last indexed one, and the index can be saved
+// and loaded to avoid rescanning the history on every run.
+//
+// Scanned blocks are never rescanned, so the index is only as final as its confirmation
+// depth (see SetConfirmations): the transfers of blocks orphaned by a deeper reorg stay in
+// the index, and in the files it is saved to.
+type OwnershipIndex struct {
+	backend       TransferBackend
+	fromBlock     uint64
+	chunkSize     uint64
+	confirmations uint64
+
+	mu          sync.RWMutex
+	collections []*collectionOwnership // in DavinciDao.collections order
+}
+
+// collectionOwnership is the ownership state of a collection
+type collectionOwnership struct {
+	address   common.Address
+	nextBlock uint64                                 // first block not scanned yet
+	owners    map[string]common.Address              // token ID → owner
+	tokens    map[common.Address]map[string]struct{} // owner → token IDs
+}
+
+// NewOwnershipIndex creates an empty index. Collections are scanned from fromBlock, which
+// should be the block the oldest collection was deployed at.
+func NewOwnershipIndex(backend TransferBackend, fromBlock uint64) *OwnershipIndex {
+	return &OwnershipIndex{
+		backend:       backend,
+		fromBlock:     fromBlock,
+		chunkSize:     defaultTransferChunkSize,
+		confirmations: defaultConfirmations,
+	}
+}
+
+// SetChunkSize sets the number of blocks requested per eth_getLogs call
+func (x *OwnershipIndex) SetChunkSize(blocks uint64) {
+	if blocks > 0 {
+		x.chunkSize = blocks
+	}
+}
+
+// SetConfirmations sets how many blocks behind the head Update stops, so that only blocks
+// that can no longer be reorged are indexed (64 by default). 0 scans up to the head.
+func (x *OwnershipIndex) SetConfirmations(blocks uint64) {
+	x.confirmations = blocks
+}
+
+// SetCollections sets the indexed collections, in DavinciDao.collections order. Collections
+// already indexed keep their state, and a collection registered more than once shares a single
+// state; the others are scanned from the start block on the next Update.
+func (x *OwnershipIndex) SetCollections(addresses []common.Address) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	byAddress := make(map[common.Address]*collectionOwnership, len(x.collections))
+	for _, c := range x.collections {
+		byAddress[c.address] = c
+	}
+	collections := make([]*collectionOwnership, len(addresses))
+	for i, address := range addresses {
+		c := byAddress[address]
+		if c == nil {
+			c = newCollectionOwnership(address, x.fromBlock)
+			byAddress[address] = c
+		}
+		collections[i] = c
+	}
+	x.collections = collections
+}
+
+// SyncCollections indexes the collections registered in the census contract
+func (x *OwnershipIndex) SyncCollections(ctx context.Context, censusContract *census.DavinciDao) error {
+	addresses, err := GetCollectionAddresses(ctx, censusContract)
+	if err != nil {
+		return err
+	}
+
+	x.SetCollections(addresses)
+	return nil
+}
+
+// Update scans the Transfer logs recorded since the last update, up to the confirmation
+// depth behind the current head. It returns the block the index is up to date with.
+func (x *OwnershipIndex) Update(ctx context.Context) (uint64, error) {
+	latest, err := x.backend.BlockNumber(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get head block: %w", err)
+	}
+	if latest < x.confirmations {
+		return 0, nil
+	}
+	head := latest - x.confirmations
+
+	// Collections added later start further behind: scan each starting block separately,
+	// all the collections sharing it in the same requests
+	x.mu.RLock()
+	groups := make(map[uint64][]common.Address)
+	for i, c := range x.collections {
+		if x.firstIndex(c) == i && c.nextBlock <= head {
+			groups[c.nextBlock] = append(groups[c.nextBlock], c.address)
+		}
+	}
+	x.mu.RUnlock()
+
+	for from, addresses := range groups {
+		if err := x.scan(ctx, addresses, from, head); err != nil {
+			return 0, err
+		}
+	}
+	return head, nil
+}
+
+// scan applies the Transfer logs of the collections in [from, to], chunk by chunk.
+// The index stays consistent if it fails: scanned chunks remain applied.
+func (x *OwnershipIndex) scan(ctx context.Context, addresses []common.Address, from, to uint64) error {
+	for start := from; start <= to; start += x.chunkSize {
+		end := min(start+x.chunkSize-1, to)
+
+		logs, err := x.backend.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: addresses,
+			Topics:    [][]common.Hash{{transferTopic}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to filter transfer logs in blocks %d-%d: %w", start, end, err)
+		}
+		sort.Slice(logs, func(i, j int) bool {
+			if logs[i].BlockNumber != logs[j].BlockNumber {
+				return logs[i].BlockNumber < logs[j].BlockNumber
+			}
+			return logs[i].Index < logs[j].Index
+		})
+
+		x.mu.Lock()
+		byAddress := make(map[common.Address]*collectionOwnership, len(x.collections))
+		for _, c := range x.collections {
+			byAddress[c.address] = c
+		}
+		for _, log := range logs {
+			if log.Removed || len(log.Topics) != 4 {
+				continue
+			}
+			if c := byAddress[log.Address]; c != nil {
+				recipient := common.BytesToAddress(log.Topics[2].Bytes())
+				c.transfer(log.Topics[3].Big().String(), recipient)
+			}
+		}
+		for _, address := range addresses {
+			if c := byAddress[address]; c != nil {
+				c.nextBlock = end + 1
+			}
+		}
+		x.mu.Unlock()
+	}
+	return nil
+}
+
+// TokensOf returns the tokens owned by the address in every indexed collection, sorted by
+// collection and token ID. DelegatedTo is not resolved (see DiscoverOwnedNFTsFromLogs).
+func (x *OwnershipIndex) TokensOf(owner common.Address) []*TokenInfo {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	tokens := make([]*TokenInfo, 0)
+	for i, c := range x.collections {
+		if x.firstIndex(c) != i {
+			continue // registered more than once: reported under the first index
+		}
+		ids := make([]*big.Int, 0, len(c.tokens[owner]))
+		for id := range c.tokens[owner] {
+			tokenID, _ := new(big.Int).SetString(id, 10)
+			ids = append(ids, tokenID)
+		}
+		sort.Slice(ids, func(a, b int) bool { return ids[a].Cmp(ids[b]) < 0 })
+
+		for _, tokenID := range ids {
+			tokens = append(tokens, &TokenInfo{
+				CollectionIndex: big.NewInt(int64(i)),
+				CollectionAddr:  c.address,
+				TokenID:         tokenID,
+			})
+		}
+	}
+	return tokens
+}
+
+// OwnerOf returns the owner of a token according to the indexed logs.
+// ok is false if the token was never minted or has been burned.
+func (x *OwnershipIndex) OwnerOf(collectionIndex int, tokenID *big.Int) (owner common.Address, ok bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if collectionIndex < 0 || collectionIndex >= len(x.collections) {
+		return common.Address{}, false
+	}
+	owner, ok = x.collections[collectionIndex].owners[tokenID.String()]
+	return owner, ok
+}
+
+// LastBlock returns the last block scanned for every collection.
+// ok is false if some collection has not been scanned yet.
+func (x *OwnershipIndex) LastBlock() (block uint64, ok bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if len(x.collections) == 0 {
+		return 0, false
+	}
+	next := x.collections[0].nextBlock
+	for _, c := range x.collections[1:] {
+		next = min(next, c.nextBlock)
+	}
+	if next <= x.fromBlock {
+		return 0, false
+	}
+	return next - 1, true
+}
+
+// firstIndex returns the first position of a collection. Must be called with the lock held.
+func (x *OwnershipIndex) firstIndex(c *collectionOwnership) int {
+	for i, other := range x.collections {
+		if other == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// DiscoverOwnedNFTsFromLogs updates the index and returns the tokens owned by the address
+// in every collection, with their current delegate. Transfers of the blocks within the
+// confirmation depth are not reflected yet.
+func DiscoverOwnedNFTsFromLogs(
+	ctx context.Context,
+	index *OwnershipIndex,
+	censusContract *census.DavinciDao,
+	owner common.Address,
+) ([]*TokenInfo, error) {
+	if _, err := index.Update(ctx); err != nil {
+		return nil, err
+	}
+
+	// One getTokenDelegations call per collection
+	tokens := index.TokensOf(owner)
+	byCollection := make(map[int64][]*TokenInfo)
+	for _, token := range tokens {
+		byCollection[token.CollectionIndex.Int64()] = append(byCollection[token.CollectionIndex.Int64()], token)
+	}
+	for collectionIndex, collectionTokens := range byCollection {
+		tokenIDs := make([]*big.Int, len(collectionTokens))
+		for i, token := range collectionTokens {
+			tokenIDs[i] = token.TokenID
+		}
+		delegates, err := GetTokenDelegations(ctx, censusContract, big.NewInt(collectionIndex), tokenIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i, token := range collectionTokens {
+			token.DelegatedTo = delegates[i]
+		}
+	}
+	return tokens, nil
+}
+
+// newCollectionOwnership creates the empty state of a collection scanned from fromBlock
+func newCollectionOwnership(address common.Address, fromBlock uint64) *collectionOwnership {
+	return &collectionOwnership{
+		address:   address,
+		nextBlock: fromBlock,
+		owners:    make(map[string]common.Address),
+		tokens:    make(map[common.Address]map[string]struct{}),
+	}
+}
+
+// transfer moves a token to a new owner (the zero address burns it)
+func (c *collectionOwnership) transfer(tokenID string, to common.Address) {
+	if from, ok := c.owners[tokenID]; ok {
+		delete(c.tokens[from], tokenID)
+		if len(c.tokens[from]) == 0 {
+			delete(c.tokens, from)
+		}
+		delete(c.owners, tokenID)
+	}
+	if to == (common.Address{}) {
+		return
+	}
+
+	c.owners[tokenID] = to
+	if c.tokens[to] == nil {
+		c.tokens[to] = make(map[string]struct{})
+	}
+	c.tokens[to][tokenID] = struct{}{}
+}
+
+// ownershipIndexFile is the saved representation of an OwnershipIndex
+type ownershipIndexFile struct {
+	Version     int                  `json:"version"`
+	FromBlock   uint64               `json:"fromBlock"`
+	Collections []ownershipFileEntry `json:"collections"`
+}
+
+// ownershipFileEntry is the saved state of a collection
+type ownershipFileEntry struct {
+	Address   common.Address            `json:"address"`
+	NextBlock uint64                    `json:"nextBlock"`
+	Owners    map[string]common.Address `json:"owners"` // token ID → owner
+}
+
+// Save writes the index to path as JSON. The file is replaced atomically.
+func (x *OwnershipIndex) Save(path string) error {
+	x.mu.RLock()
+	file := ownershipIndexFile{
+		Version:     ownershipIndexVersion,
+		FromBlock:   x.fromBlock,
+		Collections: make([]ownershipFileEntry, len(x.collections)),
+	}
+	for i, c := range x.collections {
+		file.Collections[i] = ownershipFileEntry{Address: c.address, NextBlock: c.nextBlock, Owners: c.owners}
+	}
+	data, err := json.Marshal(file)
+	x.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal ownership index: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create ownership index file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write ownership index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close ownership index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace ownership index: %w", err)
+	}
+	return nil
+}
+
+// LoadOwnershipIndex reads an index saved with Save. The next Update resumes after the
+// last block it had scanned.
+func LoadOwnershipIndex(path string, backend TransferBackend) (*OwnershipIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ownership index: %w", err)
+	}
+
+	var file ownershipIndexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ownership index: %w", err)
+	}
+	if file.Version != ownershipIndexVersion {
+		return nil, fmt.Errorf("unsupported ownership index version %d", file.Version)
+	}
+
+	index := NewOwnershipIndex(backend, file.FromBlock)
+	byAddress := make(map[common.Address]*collectionOwnership, len(file.Collections))
+	for _, entry := range file.Collections {
+		c := byAddress[entry.Address]
+		if c == nil {
+			c = newCollectionOwnership(entry.Address, entry.NextBlock)
+			for tokenID, owner := range entry.Owners {
+				c.transfer(tokenID, owner)
+			}
+			byAddress[entry.Address] = c
+		}
+		index.collections = append(index.collections, c)
+	}
+	return index, nil
+}
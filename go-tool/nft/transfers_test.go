@@ -0,0 +1,249 @@
+package nft
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	collectionA = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	collectionB = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	alice       = common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob         = common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+	carol       = common.HexToAddress("0x00000000000000000000000000000000000ca201")
+)
+
+// transferChain is an in-memory TransferBackend
+type transferChain struct {
+	head    uint64
+	logs    []types.Log
+	queries []ethereum.FilterQuery
+}
+
+func (c *transferChain) FilterLogs(_ context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	c.queries = append(c.queries, query)
+	var result []types.Log
+	for _, log := range c.logs {
+		if log.BlockNumber < query.FromBlock.Uint64() || log.BlockNumber > query.ToBlock.Uint64() {
+			continue
+		}
+		for _, address := range query.Addresses {
+			if log.Address == address {
+				result = append(result, log)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *transferChain) BlockNumber(context.Context) (uint64, error) {
+	return c.head, nil
+}
+
+// transfer appends an ERC-721 Transfer log (from or to the zero address for mints and burns)
+func (c *transferChain) transfer(collection, from, to common.Address, tokenID int64, block uint64, index uint) {
+	c.logs = append(c.logs, types.Log{
+		Address: collection,
+		Topics: []common.Hash{
+			transferTopic,
+			common.BytesToHash(from.Bytes()),
+			common.BytesToHash(to.Bytes()),
+			common.BigToHash(big.NewInt(tokenID)),
+		},
+		BlockNumber: block,
+		Index:       index,
+	})
+}
+
+// checkTokens checks the tokens owned by an account, as collectionIndex/tokenID pairs
+func checkTokens(t *testing.T, index *OwnershipIndex, owner common.Address, want ...[2]int64) {
+	t.Helper()
+	tokens := index.TokensOf(owner)
+	if len(tokens) != len(want) {
+		t.Fatalf("%s owns %d tokens, want %d", owner.Hex(), len(tokens), len(want))
+	}
+	for i, token := range tokens {
+		if token.CollectionIndex.Int64() != want[i][0] || token.TokenID.Int64() != want[i][1] {
+			t.Fatalf("token %d of %s = %d/%d, want %d/%d",
+				i, owner.Hex(), token.CollectionIndex, token.TokenID, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestOwnershipIndexOrdering(t *testing.T) {
+	ctx := context.Background()
+	chain := &transferChain{head: 20}
+	zero := common.Address{}
+
+	// Logs are returned out of order: the index must apply them by (block, log index)
+	chain.transfer(collectionA, bob, carol, 1, 7, 1)
+	chain.transfer(collectionA, alice, bob, 1, 5, 3)
+	chain.transfer(collectionA, zero, alice, 1, 5, 0)
+	chain.transfer(collectionA, alice, zero, 2, 8, 0)
+	chain.transfer(collectionA, zero, alice, 2, 6, 2)
+	chain.transfer(collectionB, zero, bob, 3, 9, 0)
+	chain.transfer(collectionB, zero, bob, 4, 9, 1)
+	// ERC-20 transfers (token ID not indexed) and removed logs are ignored
+	chain.logs = append(chain.logs,
+		types.Log{Address: collectionB, Topics: chain.logs[5].Topics[:3], BlockNumber: 9, Index: 2},
+		types.Log{Address: collectionB, Topics: chain.logs[6].Topics, BlockNumber: 9, Index: 1, Removed: true},
+	)
+
+	index := NewOwnershipIndex(chain, 5)
+	index.SetConfirmations(0)
+	index.SetChunkSize(2) // blocks 5 and 6 share a chunk, as do 7 and 8
+	index.SetCollections([]common.Address{collectionA, collectionB})
+	if head, err := index.Update(ctx); err != nil || head != 20 {
+		t.Fatalf("Update = (%d, %v), want (20, nil)", head, err)
+	}
+
+	checkTokens(t, index, alice)
+	checkTokens(t, index, carol, [2]int64{0, 1})
+	checkTokens(t, index, bob, [2]int64{1, 3}, [2]int64{1, 4})
+	if _, ok := index.OwnerOf(0, big.NewInt(2)); ok {
+		t.Fatal("burned token 2 still has an owner")
+	}
+	if last, ok := index.LastBlock(); !ok || last != 20 {
+		t.Fatalf("LastBlock = (%d, %v), want (20, true)", last, ok)
+	}
+
+	// Update only scans the new blocks
+	chain.queries = nil
+	chain.head = 22
+	chain.transfer(collectionB, bob, alice, 3, 21, 0)
+	if _, err := index.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.queries) != 1 || chain.queries[0].FromBlock.Uint64() != 21 {
+		t.Fatalf("incremental update queried %v, want blocks 21-22 only", chain.queries)
+	}
+	checkTokens(t, index, alice, [2]int64{1, 3})
+}
+
+func TestOwnershipIndexSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	chain := &transferChain{head: 10}
+	chain.transfer(collectionA, common.Address{}, alice, 1, 5, 0)
+	chain.transfer(collectionB, common.Address{}, bob, 7, 6, 0)
+
+	index := NewOwnershipIndex(chain, 1)
+	index.SetConfirmations(0)
+	index.SetCollections([]common.Address{collectionA, collectionB})
+	if _, err := index.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ownership.json")
+	if err := index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOwnershipIndex(path, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.SetConfirmations(0)
+	checkTokens(t, loaded, alice, [2]int64{0, 1})
+	checkTokens(t, loaded, bob, [2]int64{1, 7})
+	if last, ok := loaded.LastBlock(); !ok || last != 10 {
+		t.Fatalf("loaded LastBlock = (%d, %v), want (10, true)", last, ok)
+	}
+
+	// The loaded index resumes after the saved block
+	chain.queries = nil
+	chain.head = 12
+	chain.transfer(collectionA, alice, bob, 1, 11, 0)
+	if _, err := loaded.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.queries) != 1 || chain.queries[0].FromBlock.Uint64() != 11 {
+		t.Fatalf("loaded index queried %v, want blocks 11-12 only", chain.queries)
+	}
+	checkTokens(t, loaded, alice)
+	checkTokens(t, loaded, bob, [2]int64{0, 1}, [2]int64{1, 7})
+}
+
+func TestOwnershipIndexDuplicateCollection(t *testing.T) {
+	ctx := context.Background()
+	chain := &transferChain{head: 10}
+	chain.transfer(collectionA, common.Address{}, alice, 1, 5, 0)
+	chain.transfer(collectionB, common.Address{}, alice, 2, 5, 1)
+
+	// The same collection registered twice shares its state
+	index := NewOwnershipIndex(chain, 1)
+	index.SetConfirmations(0)
+	index.SetCollections([]common.Address{collectionA, collectionB, collectionA})
+	if _, err := index.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, collectionIndex := range []int{0, 2} {
+		if owner, ok := index.OwnerOf(collectionIndex, big.NewInt(1)); !ok || owner != alice {
+			t.Fatalf("OwnerOf(%d, 1) = (%s, %v), want alice", collectionIndex, owner.Hex(), ok)
+		}
+	}
+	checkTokens(t, index, alice, [2]int64{0, 1}, [2]int64{1, 2})
+
+	path := filepath.Join(t.TempDir(), "ownership.json")
+	if err := index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOwnershipIndex(path, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.SetConfirmations(0)
+	chain.head = 11
+	chain.transfer(collectionA, alice, bob, 1, 11, 0)
+	if _, err := loaded.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, collectionIndex := range []int{0, 2} {
+		if owner, _ := loaded.OwnerOf(collectionIndex, big.NewInt(1)); owner != bob {
+			t.Fatalf("loaded OwnerOf(%d, 1) = %s, want bob", collectionIndex, owner.Hex())
+		}
+	}
+}
+
+func TestOwnershipIndexConfirmations(t *testing.T) {
+	ctx := context.Background()
+	chain := &transferChain{head: 3}
+	chain.transfer(collectionA, common.Address{}, alice, 1, 5, 0)
+	chain.transfer(collectionA, common.Address{}, alice, 2, 8, 0)
+
+	index := NewOwnershipIndex(chain, 1)
+	index.SetConfirmations(4)
+	index.SetCollections([]common.Address{collectionA})
+
+	// Nothing is confirmed yet
+	if head, err := index.Update(ctx); err != nil || head != 0 {
+		t.Fatalf("Update = (%d, %v), want (0, nil)", head, err)
+	}
+	if len(chain.queries) != 0 {
+		t.Fatalf("unconfirmed blocks queried: %v", chain.queries)
+	}
+
+	// Block 8 is not confirmed at head 10, and is replaced by a reorg before it is
+	chain.head = 10
+	if head, err := index.Update(ctx); err != nil || head != 6 {
+		t.Fatalf("Update = (%d, %v), want (6, nil)", head, err)
+	}
+	checkTokens(t, index, alice, [2]int64{0, 1})
+
+	chain.logs = chain.logs[:1]
+	chain.transfer(collectionA, common.Address{}, bob, 2, 8, 0)
+	chain.head = 12
+	if head, err := index.Update(ctx); err != nil || head != 8 {
+		t.Fatalf("Update = (%d, %v), want (8, nil)", head, err)
+	}
+	checkTokens(t, index, alice, [2]int64{0, 1})
+	checkTokens(t, index, bob, [2]int64{0, 2})
+	if last, ok := index.LastBlock(); !ok || last != 8 {
+		t.Fatalf("LastBlock = (%d, %v), want (8, true)", last, ok)
+	}
+}
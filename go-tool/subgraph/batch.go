@@ -0,0 +1,193 @@
+package subgraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxBatchSize is the number of aliased fields sent per request, to stay below the
+// query complexity limits of hosted indexers
+const maxBatchSize = 100
+
+// Batch collects entity lookups of any kind and executes them in as few GraphQL requests as
+// possible, each lookup being an aliased root field (`q0: account(id: ...) {...}`).
+//
+// Results are available once Do returns:
+//
+//	batch := client.NewBatch()
+//	account := batch.Account(address)
+//	delegation := batch.TokenDelegation(nftIndex, tokenID)
+//	if err := batch.Do(ctx); err != nil { ... }
+//	fmt.Println(account.Value, delegation.Value)
+type Batch struct {
+	client *Client
+	items  []*batchItem
+}
+
+// BatchResult is filled by Batch.Do. Value is nil if the entity does not exist.
+type BatchResult[T any] struct {
+	Value *T
+}
+
+// batchItem is a single aliased root field
+type batchItem struct {
+	field     string
+	id        string
+	selection string
+	decode    func(json.RawMessage) error
+}
+
+// parseable is a raw subgraph result that converts into T
+type parseable[T, R any] interface {
+	*R
+	parse() (*T, error)
+}
+
+// NewBatch creates an empty batch
+func (c *Client) NewBatch() *Batch {
+	return &Batch{client: c}
+}
+
+// Len returns the number of lookups in the batch
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+// Account adds an account lookup
+func (b *Batch) Account(address common.Address) *BatchResult[Account] {
+	return addBatchItem[Account, accountResult](b, "account", strings.ToLower(address.Hex()), accountFields)
+}
+
+// Delegator adds a delegator lookup
+func (b *Batch) Delegator(address common.Address) *BatchResult[Delegator] {
+	return addBatchItem[Delegator, delegatorResult](b, "delegator", strings.ToLower(address.Hex()), delegatorFields)
+}
+
+// TokenDelegation adds a token delegation lookup
+func (b *Batch) TokenDelegation(nftIndex, tokenID *big.Int) *BatchResult[TokenDelegation] {
+	id := fmt.Sprintf("%s-%s", nftIndex.String(), tokenID.String())
+	return addBatchItem[TokenDelegation, tokenDelegationResult](b, "tokenDelegation", id, tokenDelegationFields)
+}
+
+// GlobalStats adds a global statistics lookup
+func (b *Batch) GlobalStats() *BatchResult[GlobalStats] {
+	return addBatchItem[GlobalStats, globalStatsResult](b, "globalStats", "global", globalStatsFields)
+}
+
+// addBatchItem registers a lookup of the entity with the given ID, decoded through R
+func addBatchItem[T, R any, PR parseable[T, R]](b *Batch, field, id, selection string) *BatchResult[T] {
+	result := &BatchResult[T]{}
+	b.items = append(b.items, &batchItem{
+		field:     field,
+		id:        id,
+		selection: selection,
+		decode: func(data json.RawMessage) error {
+			if len(data) == 0 {
+				return fmt.Errorf("missing %s %s in batch response", field, id)
+			}
+			var raw PR
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return fmt.Errorf("failed to unmarshal %s %s: %w", field, id, err)
+			}
+			if raw == nil {
+				return nil
+			}
+			value, err := raw.parse()
+			if err != nil {
+				return err
+			}
+			result.Value = value
+			return nil
+		},
+	})
+	return result
+}
+
+// Do executes all the lookups of the batch, maxBatchSize per request
+func (b *Batch) Do(ctx context.Context) error {
+	for start := 0; start < len(b.items); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(b.items))
+		if err := b.do(ctx, b.items[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// do executes a chunk of lookups in a single request
+func (b *Batch) do(ctx context.Context, items []*batchItem) error {
+	var query strings.Builder
+	query.WriteString("query Batch($block: Block_height) {\n")
+	for i, item := range items {
+		// JSON string literals are valid GraphQL string literals
+		id, err := json.Marshal(item.id)
+		if err != nil {
+			return fmt.Errorf("failed to encode id %q: %w", item.id, err)
+		}
+		fmt.Fprintf(&query, "\t\t\tq%d: %s(id: %s, block: $block) {%s\t\t\t}\n", i, item.field, id, item.selection)
+	}
+	query.WriteString("\t\t}")
+
+	var result map[string]json.RawMessage
+	if err := b.client.query(ctx, query.String(), nil, &result); err != nil {
+		return err
+	}
+
+	for i, item := range items {
+		if err := item.decode(result[fmt.Sprintf("q%d", i)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAccounts retrieves the accounts of the given addresses with `id_in` filters, in one
+// request per 1000 addresses. Addresses that never had weight are absent from the result.
+func (c *Client) GetAccounts(ctx context.Context, addresses []common.Address) (map[common.Address]*Account, error) {
+	query := `
+		query GetAccounts($ids: [ID!]!, $first: Int!, $block: Block_height) {
+			accounts(
+				first: $first
+				block: $block
+				where: { id_in: $ids }
+			) {` + accountFields + `			}
+		}
+	`
+
+	accounts := make(map[common.Address]*Account, len(addresses))
+	for start := 0; start < len(addresses); start += maxPageSize {
+		end := min(start+maxPageSize, len(addresses))
+
+		ids := make([]string, 0, end-start)
+		for _, address := range addresses[start:end] {
+			ids = append(ids, strings.ToLower(address.Hex()))
+		}
+		variables := map[string]interface{}{
+			"ids":   ids,
+			"first": maxPageSize,
+		}
+
+		var result struct {
+			Accounts []*accountResult `json:"accounts"`
+		}
+
+		if err := c.query(ctx, query, variables, &result); err != nil {
+			return nil, err
+		}
+
+		for _, r := range result.Accounts {
+			account, err := r.parse()
+			if err != nil {
+				return nil, err
+			}
+			accounts[account.Address] = account
+		}
+	}
+
+	return accounts, nil
+}
@@ -0,0 +1,60 @@
+package subgraph_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+func TestAccountLookups(t *testing.T) {
+	alice := common.HexToAddress("0x00000000000000000000000000000000000A11CE")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000B0B")
+	carol := common.HexToAddress("0x00000000000000000000000000000000000CA201")
+
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{
+		Head: 100,
+		Accounts: []*subgraph.Account{
+			{Address: alice, Weight: big.NewInt(3), TreeIndex: 0},
+			{Address: bob, Weight: big.NewInt(0), TreeIndex: -1},
+		},
+		GlobalStats: &subgraph.GlobalStats{TotalAccounts: big.NewInt(1), NextTreeIndex: 2},
+	})
+	defer server.Close()
+	client := server.Client()
+	ctx := context.Background()
+
+	account, err := client.GetAccount(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account == nil || account.Address != alice || account.Weight.Int64() != 3 {
+		t.Fatalf("GetAccount(alice) = %+v", account)
+	}
+	if account, err := client.GetAccount(ctx, carol); err != nil || account != nil {
+		t.Fatalf("GetAccount(carol) = %+v, %v, want nil", account, err)
+	}
+
+	accounts, err := client.GetAccounts(ctx, []common.Address{alice, bob, carol})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[bob] == nil || accounts[bob].TreeIndex != -1 {
+		t.Fatalf("GetAccounts = %v", accounts)
+	}
+
+	batch := client.NewBatch()
+	a := batch.Account(alice)
+	c := batch.Account(carol)
+	stats := batch.GlobalStats()
+	if err := batch.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a.Value == nil || c.Value != nil || stats.Value == nil || stats.Value.NextTreeIndex != 2 {
+		t.Fatalf("batch results: alice %+v, carol %+v, stats %+v", a.Value, c.Value, stats.Value)
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -15,43 +19,28 @@ import (
 
 const (
 	defaultTimeout = 30 * time.Second
+
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 30 * time.Second
 )
 
 // Client is a GraphQL client for querying the DavinciDAO subgraph
 type Client struct {
 	url        string
 	httpClient *http.Client
-}
+	timeout    time.Duration // per request, 0 for none
+	headers    http.Header
+	block      *uint64 // if set, all queries read the state at this block
 
-
-// tokenDelegation represents a delegated token
-type tokenDelegation struct {
-	ID               string   `json:"id"`
-	NftIndex         string   `json:"nftIndex"`
-	TokenID          string   `json:"tokenId"`
-	Delegate         string   `json:"delegate"`
-	Owner            string   `json:"owner"`
-	IsDelegated      bool     `json:"isDelegated"`
-	DelegatedAt      string   `json:"delegatedAt"`
-	DelegatedBlock   string   `json:"delegatedBlock"`
-	TransactionHash  string   `json:"transactionHash"`
-}
-
-// censusRoot represents a census root snapshot
-type censusRoot struct {
-	ID              string `json:"id"`
-	Root            string `json:"root"`
-	Updater         string `json:"updater"`
-	BlockNumber     string `json:"blockNumber"`
-	BlockTimestamp  string `json:"blockTimestamp"`
-	TransactionHash string `json:"transactionHash"`
+	retry   retryPolicy
+	limiter *rateLimiter // shared by the copies returned by AtBlock, nil if unlimited
 }
 
-
 // WeightChangeEvent represents a weight change event for tree reconstruction (exported for census package)
 type WeightChangeEvent struct {
-	ID              string `json:"id"`
-	Account         struct {
+	ID      string `json:"id"`
+	Account struct {
 		ID      string `json:"id"`
 		Address string `json:"address"`
 	} `json:"account"`
@@ -76,17 +65,54 @@ type graphQLResponse struct {
 }
 
 // NewClient creates a new subgraph client for the given URL
-func NewClient(url string) *Client {
-	return &Client{
-		url: url,
-		httpClient: &http.Client{
-			Timeout: defaultTimeout,
+func NewClient(url string, opts ...Option) *Client {
+	c := &Client{
+		url:        url,
+		httpClient: &http.Client{},
+		timeout:    defaultTimeout,
+		headers:    make(http.Header),
+		retry: retryPolicy{
+			maxRetries: defaultMaxRetries,
+			baseDelay:  defaultRetryBaseDelay,
+			maxDelay:   defaultRetryMaxDelay,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// AtBlock returns a copy of the client whose queries are all pinned to the given block
+// (`block: {number: N}`), so that multiple queries read a consistent state even if the
+// subgraph keeps indexing in between. The original client is not modified.
+func (c *Client) AtBlock(number uint64) *Client {
+	pinned := *c
+	pinned.block = &number
+	return &pinned
+}
+
+// Block returns the block the client is pinned to, or nil if queries read the latest state
+func (c *Client) Block() *uint64 {
+	if c.block == nil {
+		return nil
+	}
+	number := *c.block
+	return &number
 }
 
-// query executes a GraphQL query
+// query executes a GraphQL query. Every query declares an optional `$block: Block_height`
+// variable, which is set when the client is pinned to a block.
 func (c *Client) query(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error {
+	if c.block != nil {
+		pinned := make(map[string]interface{}, len(variables)+1)
+		for k, v := range variables {
+			pinned[k] = v
+		}
+		pinned["block"] = map[string]interface{}{"number": *c.block}
+		variables = pinned
+	}
+
 	reqBody := graphQLRequest{
 		Query:     query,
 		Variables: variables,
@@ -97,295 +123,556 @@ func (c *Client) query(ctx context.Context, query string, variables map[string]i
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBuffer(jsonData))
+	var body []byte
+	for attempt := 0; ; attempt++ {
+		body, err = c.post(ctx, jsonData)
+		if err == nil {
+			break
+		}
+		delay, retry := c.retry.next(attempt, err)
+		if !retry || ctx.Err() != nil {
+			return err
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+
+	var gqlResp graphQLResponse
+	if err := json.Unmarshal(body, &gqlResp); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(gqlResp.Errors) > 0 {
+		return fmt.Errorf("graphql error: %s", gqlResp.Errors[0].Message)
+	}
+
+	if err := json.Unmarshal(gqlResp.Data, result); err != nil {
+		return fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return nil
+}
+
+// post sends a single request, waiting for the rate limiter first, and returns the response body
+func (c *Client) post(ctx context.Context, jsonData []byte) ([]byte, error) {
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	for key, values := range c.headers {
+		req.Header[key] = values
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		return nil, &transportError{err: fmt.Errorf("failed to execute request: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return nil, &transportError{err: fmt.Errorf("failed to read response: %w", err)}
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
-	var gqlResp graphQLResponse
-	if err := json.Unmarshal(body, &gqlResp); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
+	return body, nil
+}
+
+// BlockRef identifies an indexed block
+type BlockRef struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// Meta is the indexing status of the subgraph
+type Meta struct {
+	Block             BlockRef // Latest indexed block (or the pinned block)
+	Deployment        string   // Subgraph deployment ID
+	HasIndexingErrors bool     // True if indexing failed at some past block
+}
+
+// Meta retrieves the indexing status of the subgraph from `_meta`
+func (c *Client) Meta(ctx context.Context) (*Meta, error) {
+	query := `
+		query GetMeta($block: Block_height) {
+			_meta(block: $block) {
+				block {
+					number
+					hash
+				}
+				deployment
+				hasIndexingErrors
+			}
+		}
+	`
+
+	var result struct {
+		Meta *struct {
+			Block struct {
+				Number uint64 `json:"number"`
+				Hash   string `json:"hash"`
+			} `json:"block"`
+			Deployment        string `json:"deployment"`
+			HasIndexingErrors bool   `json:"hasIndexingErrors"`
+		} `json:"_meta"`
 	}
 
-	if len(gqlResp.Errors) > 0 {
-		return fmt.Errorf("graphql error: %s", gqlResp.Errors[0].Message)
+	if err := c.query(ctx, query, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Meta == nil {
+		return nil, fmt.Errorf("subgraph returned no _meta")
 	}
 
-	if err := json.Unmarshal(gqlResp.Data, result); err != nil {
-		return fmt.Errorf("failed to unmarshal data: %w", err)
+	return &Meta{
+		Block: BlockRef{
+			Number: result.Meta.Block.Number,
+			Hash:   common.HexToHash(result.Meta.Block.Hash),
+		},
+		Deployment:        result.Meta.Deployment,
+		HasIndexingErrors: result.Meta.HasIndexingErrors,
+	}, nil
+}
+
+// BlockHashes returns the hashes of the given blocks as seen by the subgraph, using one
+// aliased `_meta(block: {number: N})` field per block. Blocks the subgraph has not indexed
+// yet, or has pruned from its history, make the request fail. Blocks whose hash graph-node
+// does not know (it returns null for some older blocks) are missing from the result.
+func (c *Client) BlockHashes(ctx context.Context, numbers []uint64) (map[uint64]common.Hash, error) {
+	// The block of each field is explicit, the client pin does not apply
+	unpinned := *c
+	unpinned.block = nil
+
+	hashes := make(map[uint64]common.Hash, len(numbers))
+	for start := 0; start < len(numbers); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(numbers))
+
+		var query strings.Builder
+		query.WriteString("query BlockHashes {\n")
+		for i, number := range numbers[start:end] {
+			fmt.Fprintf(&query, "\t\t\tb%d: _meta(block: { number: %d }) { block { number hash } }\n", i, number)
+		}
+		query.WriteString("\t\t}")
+
+		var result map[string]*struct {
+			Block struct {
+				Number uint64  `json:"number"`
+				Hash   *string `json:"hash"`
+			} `json:"block"`
+		}
+		if err := unpinned.query(ctx, query.String(), nil, &result); err != nil {
+			return nil, fmt.Errorf("failed to get block hashes: %w", err)
+		}
+
+		for i, number := range numbers[start:end] {
+			meta, ok := result[fmt.Sprintf("b%d", i)]
+			if !ok || meta == nil {
+				return nil, fmt.Errorf("subgraph returned no block %d", number)
+			}
+			if meta.Block.Hash == nil || *meta.Block.Hash == "" {
+				continue // unknown, not a different hash
+			}
+			hashes[number] = common.HexToHash(*meta.Block.Hash)
+		}
 	}
 
-	return nil
+	return hashes, nil
 }
 
-// Account represents an account with voting weight (exported for queries)
+// Account is an account with voting weight (a delegate)
 type Account struct {
-	ID                   string   `json:"id"`
-	Address              string   `json:"address"`
-	Weight               string   `json:"weight"`
-	LastUpdatedAt        string   `json:"lastUpdatedAt"`
-	LastUpdatedBlock     string   `json:"lastUpdatedBlock"`
+	ID                 string
+	Address            common.Address
+	Weight             *big.Int
+	LastUpdatedAt      uint64
+	LastUpdatedBlock   uint64
+	FirstInsertedAt    uint64
+	FirstInsertedBlock uint64
+	TreeIndex          int64 // Index of the leaf in the census tree, -1 if the weight is 0
 }
 
-// GetAccount retrieves account information by address
-func (c *Client) GetAccount(ctx context.Context, address common.Address) (*Account, error) {
-	query := `
-		query GetAccount($id: ID!) {
-			account(id: $id) {
+// accountResult is the raw subgraph representation of an Account
+type accountResult struct {
+	ID                 string `json:"id"`
+	Address            string `json:"address"`
+	Weight             string `json:"weight"`
+	LastUpdatedAt      string `json:"lastUpdatedAt"`
+	LastUpdatedBlock   string `json:"lastUpdatedBlock"`
+	FirstInsertedAt    string `json:"firstInsertedAt"`
+	FirstInsertedBlock string `json:"firstInsertedBlock"`
+	TreeIndex          string `json:"treeIndex"`
+}
+
+// accountFields is the selection set of Account queries
+const accountFields = `
 				id
 				address
 				weight
 				lastUpdatedAt
 				lastUpdatedBlock
-			}
+				firstInsertedAt
+				firstInsertedBlock
+				treeIndex
+`
+
+// parse converts the raw account into typed fields
+func (r *accountResult) parse() (*Account, error) {
+	var (
+		p       parser
+		account = &Account{ID: r.ID}
+	)
+	account.Address = p.address("address", r.Address)
+	account.Weight = p.bigInt("weight", r.Weight)
+	account.LastUpdatedAt = p.uint64("lastUpdatedAt", r.LastUpdatedAt)
+	account.LastUpdatedBlock = p.uint64("lastUpdatedBlock", r.LastUpdatedBlock)
+	account.FirstInsertedAt = p.uint64("firstInsertedAt", r.FirstInsertedAt)
+	account.FirstInsertedBlock = p.uint64("firstInsertedBlock", r.FirstInsertedBlock)
+	account.TreeIndex = p.int64("treeIndex", r.TreeIndex)
+	if p.err != nil {
+		return nil, fmt.Errorf("invalid account %s: %w", r.ID, p.err)
+	}
+	return account, nil
+}
+
+// GetAccount retrieves account information by address. It returns nil if the account
+// never had weight.
+func (c *Client) GetAccount(ctx context.Context, address common.Address) (*Account, error) {
+	query := `
+		query GetAccount($id: ID!, $block: Block_height) {
+			account(id: $id, block: $block) {` + accountFields + `			}
 		}
 	`
 
+	// Account IDs are lowercase addresses
 	variables := map[string]interface{}{
-		"id": address.Hex(),
+		"id": strings.ToLower(address.Hex()),
 	}
 
 	var result struct {
-		Account *Account `json:"account"`
+		Account *accountResult `json:"account"`
 	}
 
 	if err := c.query(ctx, query, variables, &result); err != nil {
 		return nil, err
 	}
+	if result.Account == nil {
+		return nil, nil
+	}
 
-	return result.Account, nil
+	return result.Account.parse()
 }
 
+// GlobalStats is the global delegation statistics
+type GlobalStats struct {
+	ID                    string
+	TotalDelegations      *big.Int // Active delegations
+	TotalAccounts         *big.Int // Accounts with weight > 0 (delegates)
+	TotalWeight           *big.Int // Sum of all weights
+	TotalUniqueDelegators *big.Int // Addresses that have ever delegated
+	TotalActiveDelegators *big.Int // Addresses with active delegations
+	LastUpdatedAt         uint64
+	NextTreeIndex         uint64 // Index of the next leaf inserted in the census tree
+}
 
-// getTokenDelegation retrieves delegation info for a specific token (internal use only)
-func (c *Client) getTokenDelegation(ctx context.Context, nftIndex, tokenID *big.Int) (*tokenDelegation, error) {
-	query := `
-		query GetTokenDelegation($id: ID!) {
-			tokenDelegation(id: $id) {
-				id
-				nftIndex
-				tokenId
-				delegate
-				owner
-				isDelegated
-				delegatedAt
-				delegatedBlock
-				transactionHash
-			}
-		}
-	`
-
-	// ID format: ${nftIndex}-${tokenId}
-	id := fmt.Sprintf("%s-%s", nftIndex.String(), tokenID.String())
-	variables := map[string]interface{}{
-		"id": id,
-	}
-
-	var result struct {
-		TokenDelegation *tokenDelegation `json:"tokenDelegation"`
-	}
+// globalStatsResult is the raw subgraph representation of GlobalStats
+type globalStatsResult struct {
+	ID                    string `json:"id"`
+	TotalDelegations      string `json:"totalDelegations"`
+	TotalAccounts         string `json:"totalAccounts"`
+	TotalWeight           string `json:"totalWeight"`
+	TotalUniqueDelegators string `json:"totalUniqueDelegators"`
+	TotalActiveDelegators string `json:"totalActiveDelegators"`
+	LastUpdatedAt         string `json:"lastUpdatedAt"`
+	NextTreeIndex         string `json:"nextTreeIndex"`
+}
 
-	if err := c.query(ctx, query, variables, &result); err != nil {
-		return nil, err
+// globalStatsFields is the selection set of GlobalStats queries
+const globalStatsFields = `
+				id
+				totalDelegations
+				totalAccounts
+				totalWeight
+				totalUniqueDelegators
+				totalActiveDelegators
+				lastUpdatedAt
+				nextTreeIndex
+`
+
+// parse converts the raw statistics into typed fields
+func (r *globalStatsResult) parse() (*GlobalStats, error) {
+	var (
+		p     parser
+		stats = &GlobalStats{ID: r.ID}
+	)
+	stats.TotalDelegations = p.bigInt("totalDelegations", r.TotalDelegations)
+	stats.TotalAccounts = p.bigInt("totalAccounts", r.TotalAccounts)
+	stats.TotalWeight = p.bigInt("totalWeight", r.TotalWeight)
+	stats.TotalUniqueDelegators = p.bigInt("totalUniqueDelegators", r.TotalUniqueDelegators)
+	stats.TotalActiveDelegators = p.bigInt("totalActiveDelegators", r.TotalActiveDelegators)
+	stats.LastUpdatedAt = p.uint64("lastUpdatedAt", r.LastUpdatedAt)
+	stats.NextTreeIndex = p.uint64("nextTreeIndex", r.NextTreeIndex)
+	if p.err != nil {
+		return nil, fmt.Errorf("invalid global stats: %w", p.err)
 	}
-
-	return result.TokenDelegation, nil
+	return stats, nil
 }
 
-// getAccountDelegations retrieves all tokens delegated to an account (internal use only)
-func (c *Client) getAccountDelegations(ctx context.Context, delegate common.Address, first int) ([]*tokenDelegation, error) {
+// GetGlobalStats retrieves global delegation statistics.
+// It returns nil if nothing was indexed yet.
+func (c *Client) GetGlobalStats(ctx context.Context) (*GlobalStats, error) {
 	query := `
-		query GetAccountDelegations($delegate: Bytes!, $first: Int!) {
-			tokenDelegations(
-				first: $first
-				where: { delegate: $delegate, isDelegated: true }
-				orderBy: delegatedAt
-				orderDirection: desc
-			) {
-				id
-				nftIndex
-				tokenId
-				delegate
-				owner
-				isDelegated
-				delegatedAt
-				delegatedBlock
-				transactionHash
-			}
+		query GetGlobalStats($block: Block_height) {
+			globalStats(id: "global", block: $block) {` + globalStatsFields + `			}
 		}
 	`
 
-	variables := map[string]interface{}{
-		"delegate": delegate.Hex(),
-		"first":    first,
-	}
-
 	var result struct {
-		TokenDelegations []*tokenDelegation `json:"tokenDelegations"`
+		GlobalStats *globalStatsResult `json:"globalStats"`
 	}
 
-	if err := c.query(ctx, query, variables, &result); err != nil {
+	if err := c.query(ctx, query, nil, &result); err != nil {
 		return nil, err
 	}
+	if result.GlobalStats == nil {
+		return nil, nil
+	}
 
-	return result.TokenDelegations, nil
+	return result.GlobalStats.parse()
 }
 
-// getLatestCensusRoots retrieves the most recent census roots (internal use only)
-func (c *Client) getLatestCensusRoots(ctx context.Context, first int) ([]*censusRoot, error) {
+// GetWeightChangeEvents retrieves weight change events for tree reconstruction using skip pagination.
+// Events are ordered by blockNumber only, so the order within a block is not stable across pages.
+//
+// Deprecated: The Graph rejects skip values over 5000; use GetWeightChangeEventsAfter.
+func (c *Client) GetWeightChangeEvents(ctx context.Context, first int, skip int) ([]*WeightChangeEvent, error) {
 	query := `
-		query GetLatestCensusRoots($first: Int!) {
-			censusRoots(
+		query GetWeightChangeEvents($first: Int!, $skip: Int!, $block: Block_height) {
+			weightChangeEvents(
 				first: $first
+				block: $block
+				skip: $skip
 				orderBy: blockNumber
-				orderDirection: desc
+				orderDirection: asc
 			) {
 				id
-				root
-				updater
+				account {
+					id
+					address
+				}
+				previousWeight
+				newWeight
 				blockNumber
 				blockTimestamp
 				transactionHash
+				logIndex
 			}
 		}
 	`
 
 	variables := map[string]interface{}{
 		"first": first,
+		"skip":  skip,
 	}
 
 	var result struct {
-		CensusRoots []*censusRoot `json:"censusRoots"`
+		WeightChangeEvents []*WeightChangeEvent `json:"weightChangeEvents"`
 	}
 
 	if err := c.query(ctx, query, variables, &result); err != nil {
 		return nil, err
 	}
 
-	return result.CensusRoots, nil
+	return result.WeightChangeEvents, nil
 }
 
-// GlobalStats represents global delegation statistics (exported for queries)
-type GlobalStats struct {
-	ID               string `json:"id"`
-	TotalDelegations string `json:"totalDelegations"`
-	TotalAccounts    string `json:"totalAccounts"`
-	TotalWeight      string `json:"totalWeight"`
-	LastUpdatedAt    string `json:"lastUpdatedAt"`
+// EventCursor is the position of a weight change event: events are totally ordered by
+// (blockNumber, logIndex)
+type EventCursor struct {
+	BlockNumber uint64
+	LogIndex    uint64
 }
 
-// GetGlobalStats retrieves global delegation statistics
-func (c *Client) GetGlobalStats(ctx context.Context) (*GlobalStats, error) {
-	query := `
-		query GetGlobalStats {
-			globalStats(id: "global") {
+// BlockEndCursor returns the cursor placed after every event of the given block
+func BlockEndCursor(block uint64) EventCursor {
+	return EventCursor{BlockNumber: block, LogIndex: math.MaxUint64}
+}
+
+// weightChangeEventFields is the selection set shared by all weight change event queries
+const weightChangeEventFields = `
 				id
-				totalDelegations
-				totalAccounts
-				totalWeight
-				lastUpdatedAt
-			}
+				account {
+					id
+					address
+				}
+				previousWeight
+				newWeight
+				blockNumber
+				blockTimestamp
+				transactionHash
+				logIndex
+`
+
+// GetWeightChangeEventsAfter retrieves up to first weight change events strictly after the
+// given cursor (from the beginning if after is nil), sorted by (blockNumber, logIndex).
+// It uses `_gt` filters instead of skip, so it works past The Graph skip limit and the
+// order is deterministic across pages. A result shorter than first means there are no
+// more events.
+func (c *Client) GetWeightChangeEventsAfter(ctx context.Context, after *EventCursor, first int) ([]*WeightChangeEvent, error) {
+	var result []*WeightChangeEvent
+	cursor := after
+
+	for len(result) < first {
+		events, done, err := c.weightChangePage(ctx, cursor, min(first-len(result), maxPageSize))
+		if err != nil {
+			return nil, err
 		}
-	`
+		result = append(result, events...)
+		if done || len(events) == 0 {
+			break
+		}
+		last, err := events[len(events)-1].Cursor()
+		if err != nil {
+			return nil, err
+		}
+		cursor = &last
+	}
 
-	var result struct {
-		GlobalStats *GlobalStats `json:"globalStats"`
+	return result, nil
+}
+
+// weightChangePage returns up to n complete, sorted events after the cursor.
+// done is true if fewer than n events are available.
+//
+// The subgraph can only order by one field, so events are first requested ordered by
+// blockNumber. If the page is full, its last block may be truncated at an arbitrary
+// logIndex, so that block is dropped and fetched again by the next page. A block with
+// more than n events is read on its own, ordered by logIndex.
+func (c *Client) weightChangePage(ctx context.Context, after *EventCursor, n int) ([]*WeightChangeEvent, bool, error) {
+	var result []*WeightChangeEvent
+
+	// Remaining events of the cursor block
+	if after != nil && after.LogIndex != math.MaxUint64 {
+		events, err := c.blockWeightChangeEvents(ctx, after.BlockNumber, int64(after.LogIndex), n)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(events) == n {
+			return events, false, nil
+		}
+		result = events
 	}
 
-	if err := c.query(ctx, query, nil, &result); err != nil {
-		return nil, err
+	// Events of the following blocks
+	want := n - len(result)
+	events, err := c.weightChangeEventsAfterBlock(ctx, after, want)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := sortWeightChangeEvents(events); err != nil {
+		return nil, false, err
+	}
+	if len(events) < want {
+		return append(result, events...), true, nil
 	}
 
-	return result.GlobalStats, nil
+	lastBlock := events[len(events)-1].BlockNumber
+	complete := events[:0]
+	for _, e := range events {
+		if e.BlockNumber != lastBlock {
+			complete = append(complete, e)
+		}
+	}
+	if len(complete) > 0 {
+		return append(result, complete...), false, nil
+	}
+
+	// The whole page belongs to a single block: read it ordered by logIndex
+	block, err := strconv.ParseUint(lastBlock, 10, 64)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid blockNumber %q: %w", lastBlock, err)
+	}
+	events, err = c.blockWeightChangeEvents(ctx, block, -1, want)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(result, events...), false, nil
 }
 
-// getDelegatedTokens retrieves delegated tokens for an NFT collection (internal use only)
-func (c *Client) getDelegatedTokens(ctx context.Context, nftIndex *big.Int, first int, skip int) ([]*tokenDelegation, error) {
+// blockWeightChangeEvents retrieves up to first events of a block with logIndex > afterLogIndex
+// (-1 for the whole block), ordered by logIndex
+func (c *Client) blockWeightChangeEvents(ctx context.Context, block uint64, afterLogIndex int64, first int) ([]*WeightChangeEvent, error) {
 	query := `
-		query GetDelegatedTokens($nftIndex: BigInt!, $first: Int!, $skip: Int!) {
-			tokenDelegations(
+		query GetBlockWeightChangeEvents($blockNumber: BigInt!, $logIndex: BigInt!, $first: Int!, $block: Block_height) {
+			weightChangeEvents(
 				first: $first
-				skip: $skip
-				where: { nftIndex: $nftIndex, isDelegated: true }
-				orderBy: tokenId
+				block: $block
+				where: { blockNumber: $blockNumber, logIndex_gt: $logIndex }
+				orderBy: logIndex
 				orderDirection: asc
-			) {
-				id
-				nftIndex
-				tokenId
-				delegate
-				owner
-				isDelegated
-				delegatedAt
-				delegatedBlock
-				transactionHash
-			}
+			) {` + weightChangeEventFields + `			}
 		}
 	`
 
 	variables := map[string]interface{}{
-		"nftIndex": nftIndex.String(),
-		"first":    first,
-		"skip":     skip,
+		"blockNumber": strconv.FormatUint(block, 10),
+		"logIndex":    strconv.FormatInt(afterLogIndex, 10),
+		"first":       first,
 	}
 
 	var result struct {
-		TokenDelegations []*tokenDelegation `json:"tokenDelegations"`
+		WeightChangeEvents []*WeightChangeEvent `json:"weightChangeEvents"`
 	}
 
 	if err := c.query(ctx, query, variables, &result); err != nil {
 		return nil, err
 	}
 
-	return result.TokenDelegations, nil
+	return result.WeightChangeEvents, nil
 }
 
-// GetWeightChangeEvents retrieves weight change events for tree reconstruction
-// Events are returned in chronological order (blockNumber ASC, logIndex ASC)
-func (c *Client) GetWeightChangeEvents(ctx context.Context, first int, skip int) ([]*WeightChangeEvent, error) {
+// weightChangeEventsAfterBlock retrieves up to first events recorded after the cursor block
+// (all blocks if after is nil), ordered by blockNumber only
+func (c *Client) weightChangeEventsAfterBlock(ctx context.Context, after *EventCursor, first int) ([]*WeightChangeEvent, error) {
 	query := `
-		query GetWeightChangeEvents($first: Int!, $skip: Int!) {
+		query GetWeightChangeEventsAfterBlock($blockNumber: BigInt!, $first: Int!, $block: Block_height) {
 			weightChangeEvents(
 				first: $first
-				skip: $skip
+				block: $block
+				where: { blockNumber_gt: $blockNumber }
 				orderBy: blockNumber
 				orderDirection: asc
-			) {
-				id
-				account {
-					id
-					address
-				}
-				previousWeight
-				newWeight
-				blockNumber
-				blockTimestamp
-				transactionHash
-				logIndex
-			}
+			) {` + weightChangeEventFields + `			}
 		}
 	`
 
+	// Block 0 (genesis) has no events, so "after block 0" covers the whole history
+	var block uint64
+	if after != nil {
+		block = after.BlockNumber
+	}
 	variables := map[string]interface{}{
-		"first": first,
-		"skip":  skip,
+		"blockNumber": strconv.FormatUint(block, 10),
+		"first":       first,
 	}
 
 	var result struct {
@@ -398,3 +685,37 @@ func (c *Client) GetWeightChangeEvents(ctx context.Context, first int, skip int)
 
 	return result.WeightChangeEvents, nil
 }
+
+// Cursor parses the position of the event
+func (e *WeightChangeEvent) Cursor() (EventCursor, error) {
+	block, err := strconv.ParseUint(e.BlockNumber, 10, 64)
+	if err != nil {
+		return EventCursor{}, fmt.Errorf("invalid blockNumber in event %s: %w", e.ID, err)
+	}
+	logIndex, err := strconv.ParseUint(e.LogIndex, 10, 64)
+	if err != nil {
+		return EventCursor{}, fmt.Errorf("invalid logIndex in event %s: %w", e.ID, err)
+	}
+	return EventCursor{BlockNumber: block, LogIndex: logIndex}, nil
+}
+
+// sortWeightChangeEvents sorts events by (blockNumber, logIndex)
+func sortWeightChangeEvents(events []*WeightChangeEvent) error {
+	cursors := make(map[*WeightChangeEvent]EventCursor, len(events))
+	for _, e := range events {
+		cursor, err := e.Cursor()
+		if err != nil {
+			return err
+		}
+		cursors[e] = cursor
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := cursors[events[i]], cursors[events[j]]
+		if a.BlockNumber != b.BlockNumber {
+			return a.BlockNumber < b.BlockNumber
+		}
+		return a.LogIndex < b.LogIndex
+	})
+	return nil
+}
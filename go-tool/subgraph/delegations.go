@@ -0,0 +1,432 @@
+package subgraph
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxPageSize is the largest `first` accepted by The Graph
+const maxPageSize = 1000
+
+// TokenDelegation is the delegation status of an NFT
+type TokenDelegation struct {
+	ID              string // ${nftIndex}-${tokenId}
+	NftIndex        *big.Int
+	TokenID         *big.Int
+	Delegate        common.Address // Zero address if undelegated
+	Owner           common.Address // Token owner at the time of the last (un)delegation
+	IsDelegated     bool
+	DelegatedAt     uint64 // Timestamp of the last delegation
+	DelegatedBlock  uint64
+	TransactionHash common.Hash
+}
+
+// tokenDelegationResult is the raw subgraph representation of a TokenDelegation
+type tokenDelegationResult struct {
+	ID              string `json:"id"`
+	NftIndex        string `json:"nftIndex"`
+	TokenID         string `json:"tokenId"`
+	Delegate        string `json:"delegate"`
+	Owner           string `json:"owner"`
+	IsDelegated     bool   `json:"isDelegated"`
+	DelegatedAt     string `json:"delegatedAt"`
+	DelegatedBlock  string `json:"delegatedBlock"`
+	TransactionHash string `json:"transactionHash"`
+}
+
+// tokenDelegationFields is the selection set of TokenDelegation queries
+const tokenDelegationFields = `
+				id
+				nftIndex
+				tokenId
+				delegate
+				owner
+				isDelegated
+				delegatedAt
+				delegatedBlock
+				transactionHash
+`
+
+// parse converts the raw delegation into typed fields
+func (r *tokenDelegationResult) parse() (*TokenDelegation, error) {
+	var (
+		p          parser
+		delegation = &TokenDelegation{ID: r.ID, IsDelegated: r.IsDelegated}
+	)
+	delegation.NftIndex = p.bigInt("nftIndex", r.NftIndex)
+	delegation.TokenID = p.bigInt("tokenId", r.TokenID)
+	delegation.Delegate = p.address("delegate", r.Delegate)
+	delegation.Owner = p.address("owner", r.Owner)
+	delegation.DelegatedAt = p.uint64("delegatedAt", r.DelegatedAt)
+	delegation.DelegatedBlock = p.uint64("delegatedBlock", r.DelegatedBlock)
+	delegation.TransactionHash = p.hash("transactionHash", r.TransactionHash)
+	if p.err != nil {
+		return nil, fmt.Errorf("invalid token delegation %s: %w", r.ID, p.err)
+	}
+	return delegation, nil
+}
+
+// parseTokenDelegations parses a list of raw delegations
+func parseTokenDelegations(results []*tokenDelegationResult) ([]*TokenDelegation, error) {
+	delegations := make([]*TokenDelegation, 0, len(results))
+	for _, r := range results {
+		delegation, err := r.parse()
+		if err != nil {
+			return nil, err
+		}
+		delegations = append(delegations, delegation)
+	}
+	return delegations, nil
+}
+
+// CensusRoot is a census root set on-chain (CensusRootUpdated)
+type CensusRoot struct {
+	ID              string // txHash-logIndex
+	Root            *big.Int
+	Updater         common.Address
+	BlockNumber     uint64
+	BlockTimestamp  uint64
+	TransactionHash common.Hash
+	LogIndex        uint64 // Parsed from the ID
+}
+
+// censusRootResult is the raw subgraph representation of a CensusRoot
+type censusRootResult struct {
+	ID              string `json:"id"`
+	Root            string `json:"root"`
+	Updater         string `json:"updater"`
+	BlockNumber     string `json:"blockNumber"`
+	BlockTimestamp  string `json:"blockTimestamp"`
+	TransactionHash string `json:"transactionHash"`
+}
+
+// censusRootFields is the selection set of CensusRoot queries
+const censusRootFields = `
+				id
+				root
+				updater
+				blockNumber
+				blockTimestamp
+				transactionHash
+`
+
+// parse converts the raw census root into typed fields
+func (r *censusRootResult) parse() (*CensusRoot, error) {
+	var (
+		p    parser
+		root = &CensusRoot{ID: r.ID}
+	)
+	root.Root = p.bigInt("root", r.Root)
+	root.Updater = p.address("updater", r.Updater)
+	root.BlockNumber = p.uint64("blockNumber", r.BlockNumber)
+	root.BlockTimestamp = p.uint64("blockTimestamp", r.BlockTimestamp)
+	root.TransactionHash = p.hash("transactionHash", r.TransactionHash)
+	// The schema has no logIndex field, the ID ends with it
+	_, logIndex, _ := strings.Cut(r.ID, "-")
+	root.LogIndex = p.uint64("id", logIndex)
+	if p.err != nil {
+		return nil, fmt.Errorf("invalid census root %s: %w", r.ID, p.err)
+	}
+	return root, nil
+}
+
+// GetTokenDelegation retrieves the delegation status of a token.
+// It returns nil if the token was never delegated.
+func (c *Client) GetTokenDelegation(ctx context.Context, nftIndex, tokenID *big.Int) (*TokenDelegation, error) {
+	query := `
+		query GetTokenDelegation($id: ID!, $block: Block_height) {
+			tokenDelegation(id: $id, block: $block) {` + tokenDelegationFields + `			}
+		}
+	`
+
+	// ID format: ${nftIndex}-${tokenId}
+	id := fmt.Sprintf("%s-%s", nftIndex.String(), tokenID.String())
+	variables := map[string]interface{}{
+		"id": id,
+	}
+
+	var result struct {
+		TokenDelegation *tokenDelegationResult `json:"tokenDelegation"`
+	}
+
+	if err := c.query(ctx, query, variables, &result); err != nil {
+		return nil, err
+	}
+	if result.TokenDelegation == nil {
+		return nil, nil
+	}
+
+	return result.TokenDelegation.parse()
+}
+
+// GetAccountDelegations retrieves a page of the tokens currently delegated to an account,
+// ordered by delegation ID. Pass the ID of the last delegation of a page as after to get
+// the next one ("" for the first page). A page shorter than first is the last one.
+// first is capped at 1000.
+func (c *Client) GetAccountDelegations(
+	ctx context.Context,
+	delegate common.Address,
+	first int,
+	after string,
+) ([]*TokenDelegation, error) {
+	query := `
+		query GetAccountDelegations($delegate: Bytes!, $first: Int!, $after: ID!, $block: Block_height) {
+			tokenDelegations(
+				first: $first
+				block: $block
+				where: { delegate: $delegate, isDelegated: true, id_gt: $after }
+				orderBy: id
+				orderDirection: asc
+			) {` + tokenDelegationFields + `			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"delegate": strings.ToLower(delegate.Hex()),
+		"first":    pageSize(first),
+		"after":    after,
+	}
+
+	var result struct {
+		TokenDelegations []*tokenDelegationResult `json:"tokenDelegations"`
+	}
+
+	if err := c.query(ctx, query, variables, &result); err != nil {
+		return nil, err
+	}
+
+	return parseTokenDelegations(result.TokenDelegations)
+}
+
+// GetDelegatedTokens retrieves a page of the currently delegated tokens of an NFT collection,
+// ordered by delegation ID. Pass the ID of the last delegation of a page as after to get
+// the next one ("" for the first page). A page shorter than first is the last one.
+// first is capped at 1000.
+func (c *Client) GetDelegatedTokens(
+	ctx context.Context,
+	nftIndex *big.Int,
+	first int,
+	after string,
+) ([]*TokenDelegation, error) {
+	query := `
+		query GetDelegatedTokens($nftIndex: BigInt!, $first: Int!, $after: ID!, $block: Block_height) {
+			tokenDelegations(
+				first: $first
+				block: $block
+				where: { nftIndex: $nftIndex, isDelegated: true, id_gt: $after }
+				orderBy: id
+				orderDirection: asc
+			) {` + tokenDelegationFields + `			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"nftIndex": nftIndex.String(),
+		"first":    pageSize(first),
+		"after":    after,
+	}
+
+	var result struct {
+		TokenDelegations []*tokenDelegationResult `json:"tokenDelegations"`
+	}
+
+	if err := c.query(ctx, query, variables, &result); err != nil {
+		return nil, err
+	}
+
+	return parseTokenDelegations(result.TokenDelegations)
+}
+
+// GetLatestCensusRoots retrieves up to first census roots, newest first (blockNumber DESC,
+// then logIndex DESC within a block). Pass the last root of a page as before to get the next,
+// older page (nil for the newest roots). A page shorter than first is the last one.
+func (c *Client) GetLatestCensusRoots(ctx context.Context, first int, before *CensusRoot) ([]*CensusRoot, error) {
+	if first <= 0 {
+		first = maxPageSize
+	}
+
+	var result []*CensusRoot
+	cursor := before
+
+	for len(result) < first {
+		roots, done, err := c.censusRootPage(ctx, cursor, min(first-len(result), maxPageSize))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, roots...)
+		if done || len(roots) == 0 {
+			break
+		}
+		cursor = roots[len(roots)-1]
+	}
+
+	return result, nil
+}
+
+// censusRootPage returns up to n complete, sorted roots older than before.
+// done is true if fewer than n roots are available.
+//
+// As for weight change events, roots are requested ordered by blockNumber, the last block
+// of a full page is dropped (it may be truncated) and a block filling a whole page is
+// read on its own.
+func (c *Client) censusRootPage(ctx context.Context, before *CensusRoot, n int) ([]*CensusRoot, bool, error) {
+	var result []*CensusRoot
+
+	// Remaining roots of the cursor block
+	if before != nil {
+		roots, err := c.blockCensusRoots(ctx, before.BlockNumber, &before.LogIndex, n)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(roots) == n {
+			return roots, false, nil
+		}
+		result = roots
+	}
+
+	// Roots of the previous blocks
+	want := n - len(result)
+	where := ""
+	variables := map[string]interface{}{}
+	if before != nil {
+		where = "where: { blockNumber_lt: $blockNumber }"
+		variables["blockNumber"] = strconv.FormatUint(before.BlockNumber, 10)
+	}
+	roots, err := c.censusRoots(ctx, where, "blockNumber", "desc", variables, want)
+	if err != nil {
+		return nil, false, err
+	}
+	sortCensusRoots(roots)
+	if len(roots) < want {
+		return append(result, roots...), true, nil
+	}
+
+	lastBlock := roots[len(roots)-1].BlockNumber
+	complete := roots[:0]
+	for _, r := range roots {
+		if r.BlockNumber != lastBlock {
+			complete = append(complete, r)
+		}
+	}
+	if len(complete) > 0 {
+		return append(result, complete...), false, nil
+	}
+
+	// The whole page belongs to a single block: read it on its own
+	roots, err = c.blockCensusRoots(ctx, lastBlock, nil, want)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(result, roots...), false, nil
+}
+
+// blockCensusRoots retrieves up to first roots of a block with a log index below
+// beforeLogIndex (nil for the whole block), ordered by logIndex DESC.
+//
+// The subgraph can only order roots by ID, which is not chronological (txHash-logIndex),
+// so the whole block is read and sorted here. Blocks hold few roots.
+func (c *Client) blockCensusRoots(ctx context.Context, block uint64, beforeLogIndex *uint64, first int) ([]*CensusRoot, error) {
+	var roots []*CensusRoot
+	afterID := ""
+	for {
+		where := "where: { blockNumber: $blockNumber }"
+		variables := map[string]interface{}{
+			"blockNumber": strconv.FormatUint(block, 10),
+		}
+		if afterID != "" {
+			where = "where: { blockNumber: $blockNumber, id_gt: $afterId }"
+			variables["afterId"] = afterID
+		}
+		page, err := c.censusRoots(ctx, where, "id", "asc", variables, maxPageSize)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, page...)
+		if len(page) < maxPageSize {
+			break
+		}
+		afterID = page[len(page)-1].ID
+	}
+
+	sortCensusRoots(roots)
+	result := roots[:0]
+	for _, r := range roots {
+		if beforeLogIndex == nil || r.LogIndex < *beforeLogIndex {
+			result = append(result, r)
+		}
+	}
+	return result[:min(first, len(result))], nil
+}
+
+// censusRoots runs a censusRoots query with the given filter and order
+func (c *Client) censusRoots(
+	ctx context.Context,
+	where string,
+	orderBy string,
+	orderDirection string,
+	variables map[string]interface{},
+	first int,
+) ([]*CensusRoot, error) {
+	params := []string{"$first: Int!", "$block: Block_height"}
+	if _, ok := variables["blockNumber"]; ok {
+		params = append(params, "$blockNumber: BigInt!")
+	}
+	if _, ok := variables["afterId"]; ok {
+		params = append(params, "$afterId: ID!")
+	}
+
+	query := `
+		query GetCensusRoots(` + strings.Join(params, ", ") + `) {
+			censusRoots(
+				first: $first
+				block: $block
+				` + where + `
+				orderBy: ` + orderBy + `
+				orderDirection: ` + orderDirection + `
+			) {` + censusRootFields + `			}
+		}
+	`
+	variables["first"] = pageSize(first)
+
+	var result struct {
+		CensusRoots []*censusRootResult `json:"censusRoots"`
+	}
+
+	if err := c.query(ctx, query, variables, &result); err != nil {
+		return nil, err
+	}
+
+	roots := make([]*CensusRoot, 0, len(result.CensusRoots))
+	for _, r := range result.CensusRoots {
+		root, err := r.parse()
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// sortCensusRoots sorts roots newest first: blockNumber DESC, then logIndex DESC
+func sortCensusRoots(roots []*CensusRoot) {
+	sort.SliceStable(roots, func(i, j int) bool {
+		if roots[i].BlockNumber != roots[j].BlockNumber {
+			return roots[i].BlockNumber > roots[j].BlockNumber
+		}
+		return roots[i].LogIndex > roots[j].LogIndex
+	})
+}
+
+// pageSize clamps first to the range accepted by The Graph
+func pageSize(first int) int {
+	if first <= 0 || first > maxPageSize {
+		return maxPageSize
+	}
+	return first
+}
@@ -0,0 +1,117 @@
+package subgraph_test
+
+import (
+	"context"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+func TestGetAccountDelegations(t *testing.T) {
+	delegate := common.HexToAddress("0x00000000000000000000000000000000000A11CE")
+	other := common.HexToAddress("0x0000000000000000000000000000000000000B0B")
+
+	var delegations []*subgraph.TokenDelegation
+	for tokenID := int64(0); tokenID < 25; tokenID++ {
+		to := delegate
+		if tokenID%5 == 0 {
+			to = other
+		}
+		delegations = append(delegations, &subgraph.TokenDelegation{
+			NftIndex:    big.NewInt(0),
+			TokenID:     big.NewInt(tokenID),
+			Delegate:    to,
+			IsDelegated: true,
+		})
+	}
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{TokenDelegations: delegations})
+	defer server.Close()
+	client := server.Client()
+
+	var (
+		got   []*subgraph.TokenDelegation
+		after string
+	)
+	for {
+		page, err := client.GetAccountDelegations(context.Background(), delegate, 7, after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page...)
+		if len(page) < 7 {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+
+	if len(got) != 20 {
+		t.Fatalf("got %d delegations, want 20", len(got))
+	}
+	for i, d := range got {
+		if d.Delegate != delegate {
+			t.Fatalf("delegation %s is to %s", d.ID, d.Delegate.Hex())
+		}
+		if i > 0 && d.ID <= got[i-1].ID {
+			t.Fatalf("delegation %s after %s", d.ID, got[i-1].ID)
+		}
+	}
+}
+
+func TestGetLatestCensusRoots(t *testing.T) {
+	// Five roots per block in blocks 1 to 10, except block 5 that fills more than a page.
+	// The transaction hashes are random, so that the ID order (txHash-logIndex) differs
+	// from the log order.
+	var roots []*subgraph.CensusRoot
+	for block := uint64(1); block <= 10; block++ {
+		count := uint64(5)
+		if block == 5 {
+			count = 12
+		}
+		for i := uint64(0); i < count; i++ {
+			var txHash common.Hash
+			for j := range txHash {
+				txHash[j] = byte(rand.N(256))
+			}
+			roots = append(roots, &subgraph.CensusRoot{
+				Root:            new(big.Int).SetUint64(block*100 + i),
+				BlockNumber:     block,
+				LogIndex:        i * 3,
+				TransactionHash: txHash,
+			})
+		}
+	}
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{CensusRoots: roots})
+	defer server.Close()
+	client := server.Client()
+
+	var (
+		got    []*subgraph.CensusRoot
+		before *subgraph.CensusRoot
+	)
+	for {
+		page, err := client.GetLatestCensusRoots(context.Background(), 7, before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page...)
+		if len(page) < 7 {
+			break
+		}
+		before = page[len(page)-1]
+	}
+
+	if len(got) != len(roots) {
+		t.Fatalf("got %d roots, want %d", len(got), len(roots))
+	}
+	// Newest first: the roots were created in increasing value order
+	for i, r := range got {
+		if want := roots[len(roots)-1-i].Root; r.Root.Cmp(want) != 0 {
+			t.Fatalf("root %d is %s (block %d, log %d), want %s", i, r.Root, r.BlockNumber, r.LogIndex, want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package subgraph
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Delegator is an address that has delegated at least one NFT
+type Delegator struct {
+	ID                   string
+	Address              common.Address
+	TotalDelegationsMade *big.Int // NFTs currently delegated
+	TotalDelegationsEver *big.Int // Delegation actions ever made, including undelegated ones
+	FirstDelegatedAt     uint64
+	FirstDelegatedBlock  uint64
+	LastDelegatedAt      uint64
+	LastDelegatedBlock   uint64
+}
+
+// delegatorResult is the raw subgraph representation of a Delegator
+type delegatorResult struct {
+	ID                   string `json:"id"`
+	Address              string `json:"address"`
+	TotalDelegationsMade string `json:"totalDelegationsMade"`
+	TotalDelegationsEver string `json:"totalDelegationsEver"`
+	FirstDelegatedAt     string `json:"firstDelegatedAt"`
+	FirstDelegatedBlock  string `json:"firstDelegatedBlock"`
+	LastDelegatedAt      string `json:"lastDelegatedAt"`
+	LastDelegatedBlock   string `json:"lastDelegatedBlock"`
+}
+
+// delegatorFields is the selection set of Delegator queries
+const delegatorFields = `
+				id
+				address
+				totalDelegationsMade
+				totalDelegationsEver
+				firstDelegatedAt
+				firstDelegatedBlock
+				lastDelegatedAt
+				lastDelegatedBlock
+`
+
+// parse converts the raw delegator into typed fields
+func (r *delegatorResult) parse() (*Delegator, error) {
+	var (
+		p         parser
+		delegator = &Delegator{ID: r.ID}
+	)
+	delegator.Address = p.address("address", r.Address)
+	delegator.TotalDelegationsMade = p.bigInt("totalDelegationsMade", r.TotalDelegationsMade)
+	delegator.TotalDelegationsEver = p.bigInt("totalDelegationsEver", r.TotalDelegationsEver)
+	delegator.FirstDelegatedAt = p.uint64("firstDelegatedAt", r.FirstDelegatedAt)
+	delegator.FirstDelegatedBlock = p.uint64("firstDelegatedBlock", r.FirstDelegatedBlock)
+	delegator.LastDelegatedAt = p.uint64("lastDelegatedAt", r.LastDelegatedAt)
+	delegator.LastDelegatedBlock = p.uint64("lastDelegatedBlock", r.LastDelegatedBlock)
+	if p.err != nil {
+		return nil, fmt.Errorf("invalid delegator %s: %w", r.ID, p.err)
+	}
+	return delegator, nil
+}
+
+// DelegatorOrder is the field delegators are sorted by
+type DelegatorOrder string
+
+const (
+	DelegatorOrderID                   DelegatorOrder = "id"
+	DelegatorOrderTotalDelegationsMade DelegatorOrder = "totalDelegationsMade"
+	DelegatorOrderTotalDelegationsEver DelegatorOrder = "totalDelegationsEver"
+	DelegatorOrderFirstDelegatedBlock  DelegatorOrder = "firstDelegatedBlock"
+	DelegatorOrderLastDelegatedBlock   DelegatorOrder = "lastDelegatedBlock"
+)
+
+// ListDelegatorsOptions selects a page of delegators
+type ListDelegatorsOptions struct {
+	First      int            // Page size, capped at 1000 (1000 if 0)
+	OrderBy    DelegatorOrder // Sort field (DelegatorOrderID if empty)
+	Descending bool
+
+	// After is the ID of the last delegator of the previous page. It is only valid when
+	// ordering by ID, and has no page limit.
+	After string
+	// Skip is the number of delegators to skip when ordering by another field.
+	// The Graph rejects values over 5000.
+	Skip int
+	// ActiveOnly returns only the delegators with delegations currently active
+	ActiveOnly bool
+}
+
+// GetDelegator retrieves a delegator by address. It returns nil if the address never delegated.
+func (c *Client) GetDelegator(ctx context.Context, address common.Address) (*Delegator, error) {
+	query := `
+		query GetDelegator($id: ID!, $block: Block_height) {
+			delegator(id: $id, block: $block) {` + delegatorFields + `			}
+		}
+	`
+
+	// Delegator IDs are lowercase addresses
+	variables := map[string]interface{}{
+		"id": strings.ToLower(address.Hex()),
+	}
+
+	var result struct {
+		Delegator *delegatorResult `json:"delegator"`
+	}
+
+	if err := c.query(ctx, query, variables, &result); err != nil {
+		return nil, err
+	}
+	if result.Delegator == nil {
+		return nil, nil
+	}
+
+	return result.Delegator.parse()
+}
+
+// ListDelegators retrieves a page of delegators. A page shorter than opts.First is the last one.
+func (c *Client) ListDelegators(ctx context.Context, opts ListDelegatorsOptions) ([]*Delegator, error) {
+	orderBy := opts.OrderBy
+	if orderBy == "" {
+		orderBy = DelegatorOrderID
+	}
+	switch orderBy {
+	case DelegatorOrderID, DelegatorOrderTotalDelegationsMade, DelegatorOrderTotalDelegationsEver,
+		DelegatorOrderFirstDelegatedBlock, DelegatorOrderLastDelegatedBlock:
+	default:
+		return nil, fmt.Errorf("unsupported delegator order %q", orderBy)
+	}
+	if opts.After != "" && orderBy != DelegatorOrderID {
+		return nil, fmt.Errorf("after cursor requires ordering by id, got %q", orderBy)
+	}
+	direction := "asc"
+	if opts.Descending {
+		direction = "desc"
+	}
+
+	// An ID cursor moves forward in the sort direction
+	where := []string{}
+	variables := map[string]interface{}{
+		"first": pageSize(opts.First),
+		"skip":  opts.Skip,
+	}
+	if opts.After != "" {
+		if opts.Descending {
+			where = append(where, "id_lt: $after")
+		} else {
+			where = append(where, "id_gt: $after")
+		}
+		variables["after"] = opts.After
+	}
+	if opts.ActiveOnly {
+		where = append(where, `totalDelegationsMade_gt: "0"`)
+	}
+
+	params := "$first: Int!, $skip: Int!, $block: Block_height"
+	if opts.After != "" {
+		params += ", $after: ID!"
+	}
+
+	query := `
+		query ListDelegators(` + params + `) {
+			delegators(
+				first: $first
+				skip: $skip
+				block: $block
+				where: { ` + strings.Join(where, ", ") + ` }
+				orderBy: ` + string(orderBy) + `
+				orderDirection: ` + direction + `
+			) {` + delegatorFields + `			}
+		}
+	`
+
+	var result struct {
+		Delegators []*delegatorResult `json:"delegators"`
+	}
+
+	if err := c.query(ctx, query, variables, &result); err != nil {
+		return nil, err
+	}
+
+	delegators := make([]*Delegator, 0, len(result.Delegators))
+	for _, r := range result.Delegators {
+		delegator, err := r.parse()
+		if err != nil {
+			return nil, err
+		}
+		delegators = append(delegators, delegator)
+	}
+	return delegators, nil
+}
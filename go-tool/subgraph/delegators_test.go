@@ -0,0 +1,210 @@
+package subgraph_test
+
+import (
+	"context"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+// testDelegators returns delegators sorted differently by each order, without ties
+func testDelegators() []*subgraph.Delegator {
+	var (
+		addresses = []int64{4, 2, 7, 5, 3, 1}
+		made      = []int64{2, 0, 5, 1, 4, 3}
+		ever      = []int64{0, 5, 4, 3, 2, 1}
+		last      = []uint64{3, 0, 4, 1, 5, 2}
+	)
+	var delegators []*subgraph.Delegator
+	for i := range addresses {
+		delegators = append(delegators, &subgraph.Delegator{
+			Address:              common.BigToAddress(big.NewInt(addresses[i] << 8)),
+			TotalDelegationsMade: big.NewInt(made[i] * 5),
+			TotalDelegationsEver: big.NewInt(ever[i]*4 + 9),
+			FirstDelegatedAt:     uint64(1000 + i),
+			FirstDelegatedBlock:  uint64(100 - i*11),
+			LastDelegatedAt:      2000 + last[i],
+			LastDelegatedBlock:   100 + last[i]*3,
+		})
+	}
+	return delegators
+}
+
+func TestListDelegators(t *testing.T) {
+	delegators := testDelegators()
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{Head: 200, Delegators: delegators})
+	defer server.Close()
+	client := server.Client()
+	ctx := context.Background()
+
+	keys := map[subgraph.DelegatorOrder]func(d *subgraph.Delegator) *big.Int{
+		subgraph.DelegatorOrderTotalDelegationsMade: func(d *subgraph.Delegator) *big.Int { return d.TotalDelegationsMade },
+		subgraph.DelegatorOrderTotalDelegationsEver: func(d *subgraph.Delegator) *big.Int { return d.TotalDelegationsEver },
+		subgraph.DelegatorOrderFirstDelegatedBlock: func(d *subgraph.Delegator) *big.Int {
+			return new(big.Int).SetUint64(d.FirstDelegatedBlock)
+		},
+		subgraph.DelegatorOrderLastDelegatedBlock: func(d *subgraph.Delegator) *big.Int {
+			return new(big.Int).SetUint64(d.LastDelegatedBlock)
+		},
+	}
+	compare := func(order subgraph.DelegatorOrder) func(a, b *subgraph.Delegator) int {
+		if key, ok := keys[order]; ok {
+			return func(a, b *subgraph.Delegator) int { return key(a).Cmp(key(b)) }
+		}
+		return func(a, b *subgraph.Delegator) int { return strings.Compare(delegatorID(a), delegatorID(b)) }
+	}
+
+	for _, order := range []subgraph.DelegatorOrder{
+		subgraph.DelegatorOrderID,
+		subgraph.DelegatorOrderTotalDelegationsMade,
+		subgraph.DelegatorOrderTotalDelegationsEver,
+		subgraph.DelegatorOrderFirstDelegatedBlock,
+		subgraph.DelegatorOrderLastDelegatedBlock,
+	} {
+		for _, descending := range []bool{false, true} {
+			want := slices.Clone(delegators)
+			slices.SortFunc(want, compare(order))
+			if descending {
+				slices.Reverse(want)
+			}
+
+			got, err := client.ListDelegators(ctx, subgraph.ListDelegatorsOptions{OrderBy: order, Descending: descending})
+			if err != nil {
+				t.Fatalf("%s (descending %v): %v", order, descending, err)
+			}
+			checkDelegators(t, string(order), got, want)
+
+			// The first bound truncates the same order
+			got, err = client.ListDelegators(ctx, subgraph.ListDelegatorsOptions{OrderBy: order, Descending: descending, First: 4})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDelegators(t, string(order)+" first 4", got, want[:4])
+
+			// As does skip
+			got, err = client.ListDelegators(ctx, subgraph.ListDelegatorsOptions{OrderBy: order, Descending: descending, Skip: 4})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDelegators(t, string(order)+" skip 4", got, want[4:])
+		}
+	}
+
+	// Pages of two by ID cursor, in both directions
+	for _, descending := range []bool{false, true} {
+		want := slices.Clone(delegators)
+		slices.SortFunc(want, compare(subgraph.DelegatorOrderID))
+		if descending {
+			slices.Reverse(want)
+		}
+		var got []*subgraph.Delegator
+		after := ""
+		for {
+			page, err := client.ListDelegators(ctx, subgraph.ListDelegatorsOptions{First: 2, After: after, Descending: descending})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, page...)
+			if len(page) < 2 {
+				break
+			}
+			after = page[len(page)-1].ID
+		}
+		checkDelegators(t, "id pages", got, want)
+	}
+
+	// Delegators without active delegations are filtered out
+	active, err := client.ListDelegators(ctx, subgraph.ListDelegatorsOptions{ActiveOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range active {
+		if d.TotalDelegationsMade.Sign() == 0 {
+			t.Fatalf("inactive delegator %s listed as active", d.ID)
+		}
+	}
+	if len(active) != len(delegators)-1 {
+		t.Fatalf("got %d active delegators, want %d", len(active), len(delegators)-1)
+	}
+
+	if _, err := client.ListDelegators(ctx, subgraph.ListDelegatorsOptions{OrderBy: "weight"}); err == nil {
+		t.Fatal("ListDelegators accepted an unknown order")
+	}
+	if _, err := client.ListDelegators(ctx, subgraph.ListDelegatorsOptions{
+		OrderBy: subgraph.DelegatorOrderLastDelegatedBlock,
+		After:   delegatorID(delegators[0]),
+	}); err == nil {
+		t.Fatal("ListDelegators accepted an ID cursor with another order")
+	}
+}
+
+func TestGetDelegator(t *testing.T) {
+	delegators := testDelegators()
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{
+		Head:       200,
+		Delegators: delegators,
+		GlobalStats: &subgraph.GlobalStats{
+			TotalDelegations:      big.NewInt(75),
+			TotalAccounts:         big.NewInt(4),
+			TotalWeight:           big.NewInt(75),
+			TotalUniqueDelegators: big.NewInt(6),
+			TotalActiveDelegators: big.NewInt(5),
+			LastUpdatedAt:         2005,
+			NextTreeIndex:         4,
+		},
+	})
+	defer server.Close()
+	client := server.Client()
+	ctx := context.Background()
+
+	want := delegators[2]
+	got, err := client.GetDelegator(ctx, want.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ID != delegatorID(want) || got.Address != want.Address ||
+		got.TotalDelegationsMade.Cmp(want.TotalDelegationsMade) != 0 ||
+		got.TotalDelegationsEver.Cmp(want.TotalDelegationsEver) != 0 ||
+		got.FirstDelegatedAt != want.FirstDelegatedAt || got.FirstDelegatedBlock != want.FirstDelegatedBlock ||
+		got.LastDelegatedAt != want.LastDelegatedAt || got.LastDelegatedBlock != want.LastDelegatedBlock {
+		t.Fatalf("GetDelegator = %+v, want %+v", got, want)
+	}
+
+	if got, err := client.GetDelegator(ctx, common.HexToAddress("0x1234")); err != nil || got != nil {
+		t.Fatalf("GetDelegator(unknown) = %+v, %v, want nil", got, err)
+	}
+
+	stats, err := client.GetGlobalStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalUniqueDelegators.Int64() != 6 || stats.TotalActiveDelegators.Int64() != 5 ||
+		stats.TotalDelegations.Int64() != 75 || stats.NextTreeIndex != 4 || stats.LastUpdatedAt != 2005 {
+		t.Fatalf("GetGlobalStats = %+v", stats)
+	}
+}
+
+// delegatorID returns the subgraph ID of a delegator: its lowercase address
+func delegatorID(d *subgraph.Delegator) string {
+	return strings.ToLower(d.Address.Hex())
+}
+
+func checkDelegators(t *testing.T, name string, got, want []*subgraph.Delegator) {
+	t.Helper()
+	ids := func(delegators []*subgraph.Delegator) []string {
+		var ids []string
+		for _, d := range delegators {
+			ids = append(ids, delegatorID(d))
+		}
+		return ids
+	}
+	if !slices.Equal(ids(got), ids(want)) {
+		t.Fatalf("%s: got %v, want %v", name, ids(got), ids(want))
+	}
+}
@@ -0,0 +1,109 @@
+package subgraph_test
+
+import (
+	"context"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+func TestGetWeightChangeEventsAfter(t *testing.T) {
+	// Block 20 has more events than fit in a page, and the fixture is not sorted
+	var events []subgraphtest.WeightChange
+	for block := uint64(10); block < 30; block++ {
+		n := uint64(3)
+		if block == 20 {
+			n = 1200
+		}
+		for logIndex := uint64(0); logIndex < n; logIndex++ {
+			events = append(events, subgraphtest.WeightChange{
+				Account:     common.BigToAddress(new(big.Int).SetUint64(block*10000 + logIndex)),
+				NewWeight:   1,
+				BlockNumber: block,
+				LogIndex:    logIndex * 2,
+			})
+		}
+	}
+	rand.Shuffle(len(events), func(i, j int) { events[i], events[j] = events[j], events[i] })
+
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{WeightChangeEvents: events})
+	defer server.Close()
+	client := server.Client()
+
+	var (
+		got    []*subgraph.WeightChangeEvent
+		cursor *subgraph.EventCursor
+	)
+	for {
+		page, err := client.GetWeightChangeEventsAfter(context.Background(), cursor, 700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page...)
+		if len(page) < 700 {
+			break
+		}
+		last, err := page[len(page)-1].Cursor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor = &last
+	}
+
+	if len(got) != len(events) {
+		t.Fatalf("got %d events, want %d", len(got), len(events))
+	}
+	var prev *subgraph.EventCursor
+	for _, e := range got {
+		c, err := e.Cursor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev != nil && (c.BlockNumber < prev.BlockNumber ||
+			c.BlockNumber == prev.BlockNumber && c.LogIndex <= prev.LogIndex) {
+			t.Fatalf("event %+v after %+v is out of order", c, *prev)
+		}
+		prev = &c
+	}
+}
+
+func TestAtBlock(t *testing.T) {
+	// Three events per block, in blocks 10 to 29
+	var events []subgraphtest.WeightChange
+	for block := uint64(10); block < 30; block++ {
+		for logIndex := uint64(0); logIndex < 3; logIndex++ {
+			events = append(events, subgraphtest.WeightChange{
+				Account:     common.BigToAddress(new(big.Int).SetUint64(block*10 + logIndex)),
+				NewWeight:   1,
+				BlockNumber: block,
+				LogIndex:    logIndex,
+			})
+		}
+	}
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{WeightChangeEvents: events})
+	defer server.Close()
+	client := server.Client()
+
+	// Pinned to block 15, only the events up to it are visible
+	pinned, err := client.AtBlock(15).GetWeightChangeEventsAfter(context.Background(), nil, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinned) != 18 {
+		t.Fatalf("got %d events at block 15, want 18", len(pinned))
+	}
+	if block := client.AtBlock(15).Block(); block == nil || *block != 15 {
+		t.Fatalf("pinned client block = %v, want 15", block)
+	}
+	if client.Block() != nil {
+		t.Fatal("AtBlock modified the original client")
+	}
+	if _, err := client.AtBlock(30).GetWeightChangeEventsAfter(context.Background(), nil, 1); err == nil {
+		t.Fatal("query pinned past the indexed head succeeded")
+	}
+}
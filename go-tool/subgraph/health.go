@@ -0,0 +1,56 @@
+package subgraph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrIndexingErrors is returned by CheckSync when the subgraph reports indexing errors
+	ErrIndexingErrors = errors.New("subgraph has indexing errors")
+	// ErrSubgraphStale is returned by CheckSync when the subgraph lags the chain head
+	ErrSubgraphStale = errors.New("subgraph is stale")
+)
+
+// HeadReader returns the current chain head (satisfied by *ethclient.Client)
+type HeadReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// SyncStatus compares the subgraph indexing status with the chain head
+type SyncStatus struct {
+	Meta *Meta
+	Head uint64 // Chain head block number
+	Lag  uint64 // Blocks the subgraph is behind the head (0 if ahead)
+}
+
+// CheckSync reads the subgraph `_meta` and the chain head, and returns ErrIndexingErrors if
+// the subgraph failed indexing, or ErrSubgraphStale if it is more than maxLag blocks behind.
+// The status is returned together with these errors so callers can report the details.
+func (c *Client) CheckSync(ctx context.Context, chain HeadReader, maxLag uint64) (*SyncStatus, error) {
+	meta, err := c.Meta(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subgraph status: %w", err)
+	}
+
+	head, err := chain.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain head: %w", err)
+	}
+
+	status := &SyncStatus{Meta: meta, Head: head}
+	if head > meta.Block.Number {
+		status.Lag = head - meta.Block.Number
+	}
+
+	if meta.HasIndexingErrors {
+		return status, fmt.Errorf("%w (indexed up to block %d)", ErrIndexingErrors, meta.Block.Number)
+	}
+	if status.Lag > maxLag {
+		return status, fmt.Errorf("%w: indexed block %d, chain head %d (%d blocks behind, max %d)",
+			ErrSubgraphStale, meta.Block.Number, head, status.Lag, maxLag)
+	}
+
+	return status, nil
+}
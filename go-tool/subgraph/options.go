@@ -0,0 +1,41 @@
+package subgraph
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests, e.g. to configure a proxy or TLS.
+// The request timeout is still applied per request (see WithTimeout).
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// WithTimeout sets the timeout of each request attempt (30s by default, 0 disables it)
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithHeader adds a header sent with every request
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.headers.Add(key, value)
+	}
+}
+
+// WithAPIKey authenticates requests with `Authorization: Bearer <key>`, as required by
+// The Graph gateway and most hosted indexers
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.headers.Set("Authorization", "Bearer "+key)
+	}
+}
@@ -0,0 +1,63 @@
+package subgraph
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// parser converts raw subgraph fields (BigInt and Bytes are strings in GraphQL) into typed
+// values. The first error is kept and later calls are no-ops, so a whole entity can be
+// parsed before checking err once.
+type parser struct {
+	err error
+}
+
+func (p *parser) fail(field, value string, err error) {
+	if p.err == nil {
+		p.err = fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+}
+
+func (p *parser) bigInt(field, value string) *big.Int {
+	n, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		p.fail(field, value, fmt.Errorf("not a decimal integer"))
+		return nil
+	}
+	return n
+}
+
+func (p *parser) uint64(field, value string) uint64 {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		p.fail(field, value, err)
+	}
+	return n
+}
+
+func (p *parser) int64(field, value string) int64 {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		p.fail(field, value, err)
+	}
+	return n
+}
+
+func (p *parser) address(field, value string) common.Address {
+	if !common.IsHexAddress(value) {
+		p.fail(field, value, fmt.Errorf("not an address"))
+		return common.Address{}
+	}
+	return common.HexToAddress(value)
+}
+
+func (p *parser) hash(field, value string) common.Hash {
+	if len(value) != 2+2*common.HashLength {
+		p.fail(field, value, fmt.Errorf("not a 32-byte hash"))
+		return common.Hash{}
+	}
+	return common.HexToHash(value)
+}
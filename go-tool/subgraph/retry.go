@@ -0,0 +1,164 @@
+package subgraph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WithRetry sets how failed requests are retried: up to maxRetries times, waiting an
+// exponentially growing, jittered delay starting at baseDelay and capped at maxDelay.
+// Transport errors, 429 and 5xx responses are retried; a Retry-After header takes
+// precedence over the computed delay, within the same maxDelay cap. Use maxRetries 0 to
+// disable retries.
+func WithRetry(maxRetries int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.retry = retryPolicy{
+			maxRetries: maxRetries,
+			baseDelay:  baseDelay,
+			maxDelay:   maxDelay,
+		}
+	}
+}
+
+// WithRateLimit limits the client to requestsPerSecond requests, spread evenly.
+// The limit is shared with the copies returned by AtBlock.
+func WithRateLimit(requestsPerSecond float64) Option {
+	return func(c *Client) {
+		if requestsPerSecond <= 0 {
+			c.limiter = nil
+			return
+		}
+		c.limiter = &rateLimiter{
+			interval: time.Duration(float64(time.Second) / requestsPerSecond),
+		}
+	}
+}
+
+// StatusError is returned when the subgraph endpoint answers with a non-200 status
+type StatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // Delay requested by the Retry-After header, 0 if absent
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
+// transportError wraps network failures, which are always retryable
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string { return e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// retryPolicy decides whether and when a failed request is retried
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// next returns the delay before retrying after the given (zero-based) attempt failed with err
+func (p retryPolicy) next(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.maxRetries {
+		return 0, false
+	}
+
+	var statusErr *StatusError
+	var transportErr *transportError
+	switch {
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode != http.StatusTooManyRequests && statusErr.StatusCode < 500 {
+			return 0, false
+		}
+		if statusErr.RetryAfter > 0 {
+			// Never stall longer than configured, whatever the server asks for
+			return min(statusErr.RetryAfter, p.maxDelay), true
+		}
+	case errors.As(err, &transportErr):
+	default:
+		return 0, false
+	}
+
+	return p.backoff(attempt), true
+}
+
+// backoff returns a random delay in [d/2, d], where d = baseDelay * 2^attempt capped at maxDelay
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.baseDelay
+	for i := 0; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// rateLimiter spaces requests at least interval apart
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next request slot. A nil limiter never blocks.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleep(ctx, time.Until(slot))
+}
+
+// sleep waits for d or until the context is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package subgraph_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+func TestRetry(t *testing.T) {
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{
+		GlobalStats: &subgraph.GlobalStats{TotalWeight: big.NewInt(7)},
+	})
+	defer server.Close()
+	client := server.Client()
+
+	server.FailNext(2, 503)
+	stats, err := client.GetGlobalStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalWeight.Int64() != 7 {
+		t.Fatalf("total weight = %s, want 7", stats.TotalWeight)
+	}
+	if got := server.Requests(); got != 3 {
+		t.Fatalf("server received %d requests, want 3", got)
+	}
+
+	// Client errors are not retried
+	server.FailNext(1, 400)
+	var statusErr *subgraph.StatusError
+	if _, err := client.GetGlobalStats(context.Background()); !errors.As(err, &statusErr) || statusErr.StatusCode != 400 {
+		t.Fatalf("GetGlobalStats error = %v, want status 400", err)
+	}
+	if got := server.Requests(); got != 4 {
+		t.Fatalf("server received %d requests, want 4", got)
+	}
+}
+
+func TestRetryAfterCapped(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"data":{"globalStats":null}}`))
+	}))
+	defer server.Close()
+	client := subgraph.NewClient(server.URL, subgraph.WithRetry(1, time.Millisecond, 10*time.Millisecond))
+
+	// The day requested by the server is capped at 10ms
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.GetGlobalStats(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("server received %d requests, want 2", got)
+	}
+}
@@ -0,0 +1,102 @@
+package subgraph
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultPollInterval is how often StreamWeightChanges polls once it has caught up
+const defaultPollInterval = 12 * time.Second
+
+// StreamOption configures StreamWeightChanges
+type StreamOption func(*streamConfig)
+
+type streamConfig struct {
+	interval time.Duration
+	onError  func(error)
+}
+
+// WithPollInterval sets how often the subgraph is polled once the stream has caught up
+func WithPollInterval(interval time.Duration) StreamOption {
+	return func(c *streamConfig) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
+
+// WithErrorHandler receives the errors the stream recovers from (failed polls) and the
+// error that stops it, if any
+func WithErrorHandler(onError func(error)) StreamOption {
+	return func(c *streamConfig) {
+		c.onError = onError
+	}
+}
+
+// StreamWeightChanges delivers, in (blockNumber, logIndex) order, all the weight change
+// events recorded at or after fromBlock, then keeps polling for new ones.
+//
+// Failed polls are reported to the error handler and retried on the next interval, resuming
+// from the last delivered event, so no event is skipped or delivered twice. The channel is
+// closed when ctx is cancelled, or if an event cannot be parsed.
+func (c *Client) StreamWeightChanges(ctx context.Context, fromBlock uint64, opts ...StreamOption) <-chan WeightChangeEvent {
+	config := streamConfig{interval: defaultPollInterval}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	report := func(err error) {
+		if config.onError != nil {
+			config.onError(err)
+		}
+	}
+
+	var cursor *EventCursor
+	if fromBlock > 0 {
+		start := BlockEndCursor(fromBlock - 1)
+		cursor = &start
+	}
+
+	ch := make(chan WeightChangeEvent)
+	go func() {
+		defer close(ch)
+
+		for {
+			events, err := c.GetWeightChangeEventsAfter(ctx, cursor, maxPageSize)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				report(fmt.Errorf("failed to poll weight changes: %w", err))
+				if sleep(ctx, config.interval) != nil {
+					return
+				}
+				continue
+			}
+
+			for _, event := range events {
+				next, err := event.Cursor()
+				if err != nil {
+					report(err)
+					return
+				}
+				select {
+				case ch <- *event:
+				case <-ctx.Done():
+					return
+				}
+				cursor = &next
+			}
+
+			// A full page means there may be more events available right away
+			if len(events) == maxPageSize {
+				continue
+			}
+			if sleep(ctx, config.interval) != nil {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
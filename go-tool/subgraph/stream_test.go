@@ -0,0 +1,133 @@
+package subgraph_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+// blockEvents returns count events of the given block, in reverse log order
+func blockEvents(block uint64, count int) []subgraphtest.WeightChange {
+	var events []subgraphtest.WeightChange
+	for i := count - 1; i >= 0; i-- {
+		events = append(events, subgraphtest.WeightChange{
+			Account:     common.BigToAddress(big.NewInt(int64(i + 1))),
+			NewWeight:   block,
+			BlockNumber: block,
+			LogIndex:    uint64(i * 2),
+		})
+	}
+	return events
+}
+
+// receive reads n events from the stream, failing after a timeout
+func receive(t *testing.T, stream <-chan subgraph.WeightChangeEvent, n int) []subgraph.EventCursor {
+	t.Helper()
+	var cursors []subgraph.EventCursor
+	for len(cursors) < n {
+		select {
+		case event, ok := <-stream:
+			if !ok {
+				t.Fatalf("stream closed after %d events, want %d", len(cursors), n)
+			}
+			cursor, err := event.Cursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursors = append(cursors, cursor)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d events, want %d", len(cursors), n)
+		}
+	}
+	return cursors
+}
+
+func TestStreamWeightChanges(t *testing.T) {
+	var events []subgraphtest.WeightChange
+	for block := uint64(5); block <= 7; block++ {
+		events = append(events, blockEvents(block, 3)...)
+	}
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{WeightChangeEvents: events})
+	defer server.Close()
+	client := server.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 100)
+	stream := client.StreamWeightChanges(ctx, 6,
+		subgraph.WithPollInterval(time.Millisecond),
+		subgraph.WithErrorHandler(func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}),
+	)
+
+	// The events from block 6 on, then the events indexed between polls, after a failed poll
+	got := receive(t, stream, 6)
+	server.FailNext(1, http.StatusBadRequest)
+	select {
+	case err := <-errs:
+		var statusErr *subgraph.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("error handler got %v, want status 400", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failed poll was not reported")
+	}
+	server.Update(func(fixture *subgraphtest.Fixture) {
+		fixture.WeightChangeEvents = append(fixture.WeightChangeEvents, blockEvents(8, 2)...)
+		fixture.Head = 8
+	})
+	got = append(got, receive(t, stream, 2)...)
+	server.Update(func(fixture *subgraphtest.Fixture) {
+		fixture.WeightChangeEvents = append(fixture.WeightChangeEvents, blockEvents(9, 4)...)
+		fixture.Head = 9
+	})
+	got = append(got, receive(t, stream, 4)...)
+
+	var want []subgraph.EventCursor
+	for _, block := range []struct {
+		number uint64
+		count  int
+	}{{6, 3}, {7, 3}, {8, 2}, {9, 4}} {
+		for i := 0; i < block.count; i++ {
+			want = append(want, subgraph.EventCursor{BlockNumber: block.number, LogIndex: uint64(i * 2)})
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("event %d at %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Nothing is delivered twice
+	select {
+	case event := <-stream:
+		t.Fatalf("unexpected event %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	select {
+	case _, ok := <-stream:
+		if ok {
+			t.Fatal("event received after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not closed after cancel")
+	}
+}
@@ -0,0 +1,567 @@
+package subgraphtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Limits enforced by The Graph on collection queries
+const (
+	maxFirst     = 1000
+	maxSkip      = 5000
+	defaultFirst = 100
+)
+
+// kind is the GraphQL type of an entity field
+type kind int
+
+const (
+	kindID kind = iota
+	kindBytes
+	kindBigInt
+	kindBool
+	kindAccount // relation to an Account, stored as its ID
+)
+
+// entityType describes an entity of the subgraph schema
+type entityType struct {
+	typeName  string // GraphQL type
+	name      string // singular query field
+	plural    string // collection query field
+	fields    map[string]kind
+	immutable bool // entities are never updated and have a blockNumber
+}
+
+var (
+	weightChangeEventType = &entityType{
+		typeName: "WeightChangeEvent",
+		name:     "weightChangeEvent",
+		plural:   "weightChangeEvents",
+		fields: map[string]kind{
+			"id": kindID, "account": kindAccount, "previousWeight": kindBigInt, "newWeight": kindBigInt,
+			"blockNumber": kindBigInt, "blockTimestamp": kindBigInt, "transactionHash": kindBytes,
+			"logIndex": kindBigInt,
+		},
+		immutable: true,
+	}
+	accountType = &entityType{
+		typeName: "Account",
+		name:     "account",
+		plural:   "accounts",
+		fields: map[string]kind{
+			"id": kindID, "address": kindBytes, "weight": kindBigInt, "lastUpdatedAt": kindBigInt,
+			"lastUpdatedBlock": kindBigInt, "firstInsertedAt": kindBigInt, "firstInsertedBlock": kindBigInt,
+			"treeIndex": kindBigInt,
+		},
+	}
+	delegatorType = &entityType{
+		typeName: "Delegator",
+		name:     "delegator",
+		plural:   "delegators",
+		fields: map[string]kind{
+			"id": kindID, "address": kindBytes, "totalDelegationsMade": kindBigInt,
+			"totalDelegationsEver": kindBigInt, "firstDelegatedAt": kindBigInt,
+			"firstDelegatedBlock": kindBigInt, "lastDelegatedAt": kindBigInt, "lastDelegatedBlock": kindBigInt,
+		},
+	}
+	tokenDelegationType = &entityType{
+		typeName: "TokenDelegation",
+		name:     "tokenDelegation",
+		plural:   "tokenDelegations",
+		fields: map[string]kind{
+			"id": kindID, "nftIndex": kindBigInt, "tokenId": kindBigInt, "delegate": kindBytes,
+			"owner": kindBytes, "isDelegated": kindBool, "delegatedAt": kindBigInt,
+			"delegatedBlock": kindBigInt, "transactionHash": kindBytes,
+		},
+	}
+	censusRootType = &entityType{
+		typeName: "CensusRoot",
+		name:     "censusRoot",
+		plural:   "censusRoots",
+		fields: map[string]kind{
+			"id": kindID, "root": kindBigInt, "updater": kindBytes, "blockNumber": kindBigInt,
+			"blockTimestamp": kindBigInt, "transactionHash": kindBytes,
+		},
+		immutable: true,
+	}
+	globalStatsType = &entityType{
+		typeName: "GlobalStats",
+		name:     "globalStats",
+		plural:   "globalStats_collection",
+		fields: map[string]kind{
+			"id": kindID, "totalDelegations": kindBigInt, "totalAccounts": kindBigInt,
+			"totalWeight": kindBigInt, "totalUniqueDelegators": kindBigInt,
+			"totalActiveDelegators": kindBigInt, "lastUpdatedAt": kindBigInt, "nextTreeIndex": kindBigInt,
+		},
+	}
+
+	entityTypes = []*entityType{
+		weightChangeEventType, accountType, delegatorType, tokenDelegationType, censusRootType, globalStatsType,
+	}
+)
+
+// filterOps are the supported where suffixes, longest first so that _not_in wins over _in
+var filterOps = []string{"_not_in", "_in", "_not", "_gte", "_lte", "_gt", "_lt"}
+
+// execute resolves the root fields of a query against the store
+func (s *store) execute(fields []*field) (map[string]any, error) {
+	data := make(map[string]any, len(fields))
+	for _, f := range fields {
+		value, err := s.resolve(f)
+		if err != nil {
+			return nil, err
+		}
+		data[f.alias] = value
+	}
+	return data, nil
+}
+
+// resolve executes a root field
+func (s *store) resolve(f *field) (any, error) {
+	block, err := s.blockArg(f.args["block"])
+	if err != nil {
+		return nil, err
+	}
+
+	if f.name == "_meta" {
+		return s.meta(f, block)
+	}
+
+	for _, t := range entityTypes {
+		switch f.name {
+		case t.name:
+			return s.single(t, f, block)
+		case t.plural:
+			return s.collection(t, f, block)
+		}
+	}
+	return nil, fmt.Errorf("Type `Query` has no field `%s`", f.name)
+}
+
+// blockArg parses the `block: {number: N}` argument. It returns the head if absent, and
+// fails like graph-node for blocks past the head or pruned from the history.
+func (s *store) blockArg(arg any) (uint64, error) {
+	if arg == nil {
+		return s.head, nil
+	}
+	block, ok := arg.(map[string]any)
+	if !ok {
+		return 0, fmt.Errorf("invalid block argument %v", arg)
+	}
+	if _, ok := block["hash"]; ok {
+		return 0, fmt.Errorf("block hash constraints are not supported by subgraphtest")
+	}
+	number, err := toUint64(block["number"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid block number: %w", err)
+	}
+	if number > s.head {
+		return 0, fmt.Errorf("Failed to decode `block.number` value: `subgraph %s has only indexed up to block number %d and data for block number %d is therefore not yet available`",
+			s.deployment, s.head, number)
+	}
+	if number < s.earliest {
+		return 0, fmt.Errorf("subgraph %s only has data starting at block number %d and data for block number %d is therefore not available",
+			s.deployment, s.earliest, number)
+	}
+	return number, nil
+}
+
+// meta resolves `_meta`
+func (s *store) meta(f *field, block uint64) (any, error) {
+	// graph-node returns a null hash for some older blocks
+	var hash any
+	if h := s.blockHash(block); h != (common.Hash{}) {
+		hash = bytesHex(h.Bytes())
+	}
+	meta := map[string]any{
+		"block": map[string]any{
+			"number": block,
+			"hash":   hash,
+		},
+		"deployment":        s.deployment,
+		"hasIndexingErrors": s.hasIndexingErrors,
+	}
+	return projectMap(meta, f.selection)
+}
+
+// single resolves `entity(id: ...)`, null if not found
+func (s *store) single(t *entityType, f *field, block uint64) (any, error) {
+	id, ok := f.args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("argument `id` of `%s` must be a string", t.name)
+	}
+	for _, e := range s.entities[t.name] {
+		if e["id"] == id && visible(t, e, block) {
+			return s.project(t, e, f.selection)
+		}
+	}
+	return nil, nil
+}
+
+// collection resolves `entities(first, skip, where, orderBy, orderDirection)`
+func (s *store) collection(t *entityType, f *field, block uint64) (any, error) {
+	first, skip := uint64(defaultFirst), uint64(0)
+	var err error
+	if arg, ok := f.args["first"]; ok && arg != nil {
+		if first, err = toUint64(arg); err != nil || first > maxFirst {
+			return nil, fmt.Errorf("The `first` argument must be between 0 and %d, but is %v", maxFirst, arg)
+		}
+	}
+	if arg, ok := f.args["skip"]; ok && arg != nil {
+		if skip, err = toUint64(arg); err != nil || skip > maxSkip {
+			return nil, fmt.Errorf("The `skip` argument must be between 0 and %d, but is %v", maxSkip, arg)
+		}
+	}
+
+	var where map[string]any
+	if arg := f.args["where"]; arg != nil {
+		if where, _ = arg.(map[string]any); where == nil {
+			return nil, fmt.Errorf("invalid where argument %v", arg)
+		}
+	}
+
+	orderBy := "id"
+	if arg := f.args["orderBy"]; arg != nil {
+		orderBy = fmt.Sprint(arg)
+		if k, ok := t.fields[orderBy]; !ok || k == kindAccount {
+			return nil, fmt.Errorf("Value not found for enum type `%s_orderBy`: %s", t.typeName, orderBy)
+		}
+	}
+	descending := false
+	if arg := f.args["orderDirection"]; arg != nil {
+		switch fmt.Sprint(arg) {
+		case "asc":
+		case "desc":
+			descending = true
+		default:
+			return nil, fmt.Errorf("Value not found for enum type `OrderDirection`: %v", arg)
+		}
+	}
+
+	var matches []entity
+	for _, e := range s.entities[t.name] {
+		if !visible(t, e, block) {
+			continue
+		}
+		ok, err := matchWhere(t, e, where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, e)
+		}
+	}
+
+	// graph-node breaks ties by ID, in the same direction
+	sort.SliceStable(matches, func(i, j int) bool {
+		c := compareValues(matches[i][orderBy], matches[j][orderBy])
+		if c == 0 {
+			c = strings.Compare(matches[i]["id"].(string), matches[j]["id"].(string))
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if skip >= uint64(len(matches)) {
+		matches = nil
+	} else {
+		matches = matches[skip:]
+	}
+	if uint64(len(matches)) > first {
+		matches = matches[:first]
+	}
+
+	result := make([]any, 0, len(matches))
+	for _, e := range matches {
+		projected, err := s.project(t, e, f.selection)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, projected)
+	}
+	return result, nil
+}
+
+// visible reports whether the entity exists at the given block. Only immutable entities
+// are versioned; mutable ones always have their latest state.
+func visible(t *entityType, e entity, block uint64) bool {
+	if !t.immutable {
+		return true
+	}
+	return e["blockNumber"].(*big.Int).Cmp(new(big.Int).SetUint64(block)) <= 0
+}
+
+// matchWhere reports whether the entity matches all the where conditions
+func matchWhere(t *entityType, e entity, where map[string]any) (bool, error) {
+	for key, arg := range where {
+		name, op := splitFilter(t, key)
+		k, ok := t.fields[name]
+		if !ok {
+			return false, fmt.Errorf("Type `%s_filter` has no field `%s`", t.typeName, key)
+		}
+
+		ok, err := matchCondition(k, e[name], op, arg)
+		if err != nil {
+			return false, fmt.Errorf("invalid value for `%s`: %w", key, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// splitFilter splits a where key into the field name and the filter suffix ("" for equality)
+func splitFilter(t *entityType, key string) (string, string) {
+	for _, suffix := range filterOps {
+		if trimmed, ok := strings.CutSuffix(key, suffix); ok {
+			if _, known := t.fields[trimmed]; known {
+				return trimmed, suffix
+			}
+		}
+	}
+	return key, ""
+}
+
+// checkVariableTypes checks that the variables passed as `id` or where arguments are
+// declared with the type of the filtered field, as graph-node does: an ID filter given a
+// String! variable is rejected.
+func checkVariableTypes(fields []*field, types map[string]string) error {
+	check := func(arg any, expected string) error {
+		v, ok := arg.(variable)
+		if !ok {
+			return nil
+		}
+		declared, ok := types[string(v)]
+		if !ok {
+			return fmt.Errorf("Variable \"$%s\" is not defined", v)
+		}
+		if base := strings.Trim(declared, "[]!"); base != expected {
+			return fmt.Errorf("Variable \"$%s\" of type \"%s\" used in position expecting type \"%s\"", v, declared, expected)
+		}
+		return nil
+	}
+
+	for _, f := range fields {
+		for _, t := range entityTypes {
+			if f.name != t.name && f.name != t.plural {
+				continue
+			}
+			if err := check(f.args["id"], "ID"); err != nil {
+				return err
+			}
+			where, _ := f.args["where"].(map[string]any)
+			for key, arg := range where {
+				name, _ := splitFilter(t, key)
+				if k, ok := t.fields[name]; ok {
+					if err := check(arg, k.graphQLType()); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// graphQLType returns the GraphQL scalar filters on a field of this kind take
+func (k kind) graphQLType() string {
+	switch k {
+	case kindID:
+		return "ID"
+	case kindBytes:
+		return "Bytes"
+	case kindBigInt:
+		return "BigInt"
+	case kindBool:
+		return "Boolean"
+	default:
+		return "String" // relations are filtered by the ID of the related entity
+	}
+}
+
+// matchCondition applies a single where condition to a field value
+func matchCondition(k kind, value any, op string, arg any) (bool, error) {
+	switch op {
+	case "_in", "_not_in":
+		list, ok := arg.([]any)
+		if !ok {
+			return false, fmt.Errorf("expected a list, got %v", arg)
+		}
+		found := false
+		for _, item := range list {
+			v, err := coerce(k, item)
+			if err != nil {
+				return false, err
+			}
+			if compareValues(value, v) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (op == "_in"), nil
+	}
+
+	v, err := coerce(k, arg)
+	if err != nil {
+		return false, err
+	}
+	if k == kindBool && op != "" && op != "_not" {
+		return false, fmt.Errorf("%s is not supported on Boolean fields", op)
+	}
+
+	c := compareValues(value, v)
+	switch op {
+	case "":
+		return c == 0, nil
+	case "_not":
+		return c != 0, nil
+	case "_gt":
+		return c > 0, nil
+	case "_gte":
+		return c >= 0, nil
+	case "_lt":
+		return c < 0, nil
+	default: // _lte
+		return c <= 0, nil
+	}
+}
+
+// coerce converts a where argument to the representation of an entity field
+func coerce(k kind, arg any) (any, error) {
+	switch k {
+	case kindBigInt:
+		var s string
+		switch arg := arg.(type) {
+		case string:
+			s = arg
+		case json.Number:
+			s = arg.String()
+		default:
+			return nil, fmt.Errorf("expected a BigInt, got %v", arg)
+		}
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid BigInt %q", s)
+		}
+		return v, nil
+	case kindBool:
+		v, ok := arg.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a Boolean, got %v", arg)
+		}
+		return v, nil
+	case kindBytes:
+		v, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected Bytes, got %v", arg)
+		}
+		return strings.ToLower(v), nil
+	default:
+		v, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %v", arg)
+		}
+		return v, nil
+	}
+}
+
+// compareValues compares two values of the same field
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case *big.Int:
+		return a.Cmp(b.(*big.Int))
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		switch {
+		case a == b.(bool):
+			return 0
+		case !a:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return 0
+}
+
+// project builds the response object of an entity for the given selection set
+func (s *store) project(t *entityType, e entity, selection []*field) (any, error) {
+	result := make(map[string]any, len(selection))
+	for _, f := range selection {
+		if f.name == "__typename" {
+			result[f.alias] = t.typeName
+			continue
+		}
+		k, ok := t.fields[f.name]
+		if !ok {
+			return nil, fmt.Errorf("Type `%s` has no field `%s`", t.typeName, f.name)
+		}
+
+		switch k {
+		case kindAccount:
+			id := e[f.name].(string)
+			account := entity{"id": id, "address": id}
+			for _, a := range s.entities[accountType.name] {
+				if a["id"] == id {
+					account = a
+					break
+				}
+			}
+			projected, err := s.project(accountType, account, f.selection)
+			if err != nil {
+				return nil, err
+			}
+			result[f.alias] = projected
+		case kindBigInt:
+			if v, ok := e[f.name].(*big.Int); ok {
+				result[f.alias] = v.String()
+			} else {
+				result[f.alias] = nil
+			}
+		default:
+			result[f.alias] = e[f.name]
+		}
+	}
+	return result, nil
+}
+
+// projectMap selects fields from a plain object, such as `_meta`
+func projectMap(object map[string]any, selection []*field) (any, error) {
+	result := make(map[string]any, len(selection))
+	for _, f := range selection {
+		value, ok := object[f.name]
+		if !ok {
+			return nil, fmt.Errorf("Type `_Meta_` has no field `%s`", f.name)
+		}
+		if nested, ok := value.(map[string]any); ok {
+			projected, err := projectMap(nested, f.selection)
+			if err != nil {
+				return nil, err
+			}
+			value = projected
+		}
+		result[f.alias] = value
+	}
+	return result, nil
+}
+
+// toUint64 converts a numeric argument (literal or variable) to uint64
+func toUint64(v any) (uint64, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return strconv.ParseUint(v.String(), 10, 64)
+	case string:
+		return strconv.ParseUint(v, 10, 64)
+	}
+	return 0, fmt.Errorf("expected a number, got %v", v)
+}
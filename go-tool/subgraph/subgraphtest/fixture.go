@@ -0,0 +1,220 @@
+package subgraphtest
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+)
+
+// Fixture is the indexed state served by a Server. IDs left empty are derived the way the
+// subgraph mapping derives them.
+type Fixture struct {
+	// Head is the latest indexed block. If 0, the highest block of the weight change
+	// events and census roots is used.
+	Head uint64
+	// EarliestBlock is the oldest block with data, as with graph-node history pruning.
+	// Queries pinned to an older block, including `_meta`, fail.
+	EarliestBlock uint64
+	// BlockHashes are the hashes reported by `_meta`. Blocks not listed get a hash
+	// derived from their number (see BlockHash), and a zero hash is reported as null, as
+	// graph-node does for some older blocks.
+	BlockHashes       map[uint64]common.Hash
+	Deployment        string
+	HasIndexingErrors bool
+
+	WeightChangeEvents []WeightChange
+	Accounts           []*subgraph.Account
+	Delegators         []*subgraph.Delegator
+	TokenDelegations   []*subgraph.TokenDelegation
+	CensusRoots        []*subgraph.CensusRoot
+	GlobalStats        *subgraph.GlobalStats
+}
+
+// WeightChange is a WeightChanged event indexed by the fixture
+type WeightChange struct {
+	Account         common.Address
+	PreviousWeight  uint64
+	NewWeight       uint64
+	BlockNumber     uint64
+	LogIndex        uint64
+	BlockTimestamp  uint64
+	TransactionHash common.Hash // BlockHash(BlockNumber) if zero
+}
+
+// BlockHash is the hash reported for blocks missing from Fixture.BlockHashes
+func BlockHash(number uint64) common.Hash {
+	return common.BigToHash(new(big.Int).SetUint64(number))
+}
+
+// entity is an indexed entity: BigInt fields are *big.Int, Bytes fields lowercase hex
+// strings and relations the ID of the related entity
+type entity map[string]any
+
+// store is the fixture converted into entities, by entity type
+type store struct {
+	entities          map[string][]entity
+	head              uint64
+	earliest          uint64
+	hashes            map[uint64]common.Hash
+	deployment        string
+	hasIndexingErrors bool
+}
+
+// newStore indexes the fixture
+func newStore(f *Fixture) *store {
+	s := &store{
+		entities:          make(map[string][]entity),
+		head:              f.Head,
+		earliest:          f.EarliestBlock,
+		hashes:            f.BlockHashes,
+		deployment:        f.Deployment,
+		hasIndexingErrors: f.HasIndexingErrors,
+	}
+	if s.deployment == "" {
+		s.deployment = "QmSubgraphTest"
+	}
+
+	var highest uint64
+	for _, e := range f.WeightChangeEvents {
+		txHash := e.TransactionHash
+		if txHash == (common.Hash{}) {
+			txHash = BlockHash(e.BlockNumber)
+		}
+		s.add(weightChangeEventType, entity{
+			"id":              fmt.Sprintf("%s-%d", bytesHex(txHash.Bytes()), e.LogIndex),
+			"account":         addressHex(e.Account),
+			"previousWeight":  new(big.Int).SetUint64(e.PreviousWeight),
+			"newWeight":       new(big.Int).SetUint64(e.NewWeight),
+			"blockNumber":     new(big.Int).SetUint64(e.BlockNumber),
+			"blockTimestamp":  new(big.Int).SetUint64(e.BlockTimestamp),
+			"transactionHash": bytesHex(txHash.Bytes()),
+			"logIndex":        new(big.Int).SetUint64(e.LogIndex),
+		})
+		highest = max(highest, e.BlockNumber)
+	}
+
+	for _, a := range f.Accounts {
+		id := a.ID
+		if id == "" {
+			id = addressHex(a.Address)
+		}
+		s.add(accountType, entity{
+			"id":                 id,
+			"address":            addressHex(a.Address),
+			"weight":             bigInt(a.Weight),
+			"lastUpdatedAt":      new(big.Int).SetUint64(a.LastUpdatedAt),
+			"lastUpdatedBlock":   new(big.Int).SetUint64(a.LastUpdatedBlock),
+			"firstInsertedAt":    new(big.Int).SetUint64(a.FirstInsertedAt),
+			"firstInsertedBlock": new(big.Int).SetUint64(a.FirstInsertedBlock),
+			"treeIndex":          big.NewInt(a.TreeIndex),
+		})
+	}
+
+	for _, d := range f.Delegators {
+		id := d.ID
+		if id == "" {
+			id = addressHex(d.Address)
+		}
+		s.add(delegatorType, entity{
+			"id":                   id,
+			"address":              addressHex(d.Address),
+			"totalDelegationsMade": bigInt(d.TotalDelegationsMade),
+			"totalDelegationsEver": bigInt(d.TotalDelegationsEver),
+			"firstDelegatedAt":     new(big.Int).SetUint64(d.FirstDelegatedAt),
+			"firstDelegatedBlock":  new(big.Int).SetUint64(d.FirstDelegatedBlock),
+			"lastDelegatedAt":      new(big.Int).SetUint64(d.LastDelegatedAt),
+			"lastDelegatedBlock":   new(big.Int).SetUint64(d.LastDelegatedBlock),
+		})
+	}
+
+	for _, d := range f.TokenDelegations {
+		id := d.ID
+		if id == "" {
+			id = fmt.Sprintf("%s-%s", bigInt(d.NftIndex), bigInt(d.TokenID))
+		}
+		s.add(tokenDelegationType, entity{
+			"id":              id,
+			"nftIndex":        bigInt(d.NftIndex),
+			"tokenId":         bigInt(d.TokenID),
+			"delegate":        addressHex(d.Delegate),
+			"owner":           addressHex(d.Owner),
+			"isDelegated":     d.IsDelegated,
+			"delegatedAt":     new(big.Int).SetUint64(d.DelegatedAt),
+			"delegatedBlock":  new(big.Int).SetUint64(d.DelegatedBlock),
+			"transactionHash": bytesHex(d.TransactionHash.Bytes()),
+		})
+	}
+
+	for _, r := range f.CensusRoots {
+		txHash := r.TransactionHash
+		if txHash == (common.Hash{}) {
+			txHash = BlockHash(r.BlockNumber)
+		}
+		id := r.ID
+		if id == "" {
+			id = fmt.Sprintf("%s-%d", bytesHex(txHash.Bytes()), r.LogIndex)
+		}
+		s.add(censusRootType, entity{
+			"id":              id,
+			"root":            bigInt(r.Root),
+			"updater":         addressHex(r.Updater),
+			"blockNumber":     new(big.Int).SetUint64(r.BlockNumber),
+			"blockTimestamp":  new(big.Int).SetUint64(r.BlockTimestamp),
+			"transactionHash": bytesHex(txHash.Bytes()),
+		})
+		highest = max(highest, r.BlockNumber)
+	}
+
+	if g := f.GlobalStats; g != nil {
+		s.add(globalStatsType, entity{
+			"id":                    "global",
+			"totalDelegations":      bigInt(g.TotalDelegations),
+			"totalAccounts":         bigInt(g.TotalAccounts),
+			"totalWeight":           bigInt(g.TotalWeight),
+			"totalUniqueDelegators": bigInt(g.TotalUniqueDelegators),
+			"totalActiveDelegators": bigInt(g.TotalActiveDelegators),
+			"lastUpdatedAt":         new(big.Int).SetUint64(g.LastUpdatedAt),
+			"nextTreeIndex":         new(big.Int).SetUint64(g.NextTreeIndex),
+		})
+	}
+
+	if s.head == 0 {
+		s.head = highest
+	}
+	return s
+}
+
+// add stores an entity of the given type
+func (s *store) add(t *entityType, e entity) {
+	s.entities[t.name] = append(s.entities[t.name], e)
+}
+
+// blockHash returns the hash reported for a block
+func (s *store) blockHash(number uint64) common.Hash {
+	if hash, ok := s.hashes[number]; ok {
+		return hash
+	}
+	return BlockHash(number)
+}
+
+// addressHex encodes an address as the subgraph stores Bytes: lowercase hex
+func addressHex(address common.Address) string {
+	return strings.ToLower(address.Hex())
+}
+
+// bytesHex encodes bytes as lowercase hex
+func bytesHex(b []byte) string {
+	return fmt.Sprintf("0x%x", b)
+}
+
+// bigInt copies a BigInt field, nil being 0
+func bigInt(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(v)
+}
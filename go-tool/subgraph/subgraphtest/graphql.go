@@ -0,0 +1,350 @@
+package subgraphtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// field is a field of a GraphQL selection set
+type field struct {
+	alias     string // response key (the name if not aliased)
+	name      string
+	args      map[string]any
+	selection []*field
+}
+
+// variable is a reference to a query variable
+type variable string
+
+// enum is an unquoted literal (orderBy: blockNumber, orderDirection: asc)
+type enum string
+
+// parseQuery parses a GraphQL query document into its root selection set, resolving the
+// variables. Only the subset of GraphQL used by subgraph queries is supported: a single
+// operation with variable definitions, aliases, arguments and nested selection sets.
+func parseQuery(query string, variables map[string]any) ([]*field, error) {
+	p := &queryParser{src: query}
+	p.next()
+
+	types := make(map[string]string)
+	if p.tok == "query" {
+		p.next()
+		if p.isName() {
+			p.next()
+		}
+		if p.tok == "(" {
+			var err error
+			if types, err = p.variableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fields, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q after the operation", p.tok)
+	}
+	if err := checkVariableTypes(fields, types); err != nil {
+		return nil, err
+	}
+	resolveVariables(fields, variables)
+	return fields, nil
+}
+
+// resolveVariables replaces variable references in the arguments with their values.
+// Undefined variables resolve to nil, like omitted optional variables.
+func resolveVariables(fields []*field, variables map[string]any) {
+	var resolve func(v any) any
+	resolve = func(v any) any {
+		switch v := v.(type) {
+		case variable:
+			return variables[string(v)]
+		case []any:
+			for i := range v {
+				v[i] = resolve(v[i])
+			}
+		case map[string]any:
+			for k := range v {
+				v[k] = resolve(v[k])
+			}
+		}
+		return v
+	}
+
+	for _, f := range fields {
+		for name, arg := range f.args {
+			f.args[name] = resolve(arg)
+		}
+		resolveVariables(f.selection, variables)
+	}
+}
+
+// queryParser is a recursive descent parser over GraphQL tokens
+type queryParser struct {
+	src string
+	pos int
+	tok string // current token, "" at the end of the input
+	err error  // lexer error
+}
+
+// next advances to the next token. Commas are insignificant, as in GraphQL.
+func (p *queryParser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ',' || unicode.IsSpace(rune(c)):
+			p.pos++
+		default:
+			p.tok = p.scan()
+			return
+		}
+	}
+	p.tok = ""
+}
+
+// scan reads the token at the current position
+func (p *queryParser) scan() string {
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case c == '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			p.err = fmt.Errorf("unterminated string")
+			return ""
+		}
+		p.pos++
+	case c == '$' || c == '_' || c == '-' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+		p.pos++
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			if c != '_' && c != '.' && !unicode.IsLetter(rune(c)) && !unicode.IsDigit(rune(c)) {
+				break
+			}
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// isName reports whether the current token is a name
+func (p *queryParser) isName() bool {
+	return p.tok != "" && (p.tok[0] == '_' || unicode.IsLetter(rune(p.tok[0])))
+}
+
+// expect consumes the given token
+func (p *queryParser) expect(tok string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.tok != tok {
+		return fmt.Errorf("expected %q, got %q", tok, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+// variableDefinitions parses `($a: Type!, $b: [Type!]! = default)` into the type of each
+// variable. Default values are skipped.
+func (p *queryParser) variableDefinitions() (map[string]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	types := make(map[string]string)
+	for p.tok != ")" {
+		if p.err != nil {
+			return nil, p.err
+		}
+		if p.tok == "" || p.tok[0] != '$' {
+			return nil, fmt.Errorf("expected variable, got %q", p.tok)
+		}
+		name := p.tok[1:]
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+
+		var typ strings.Builder
+		for p.tok == "[" || p.tok == "]" || p.tok == "!" || p.isName() {
+			typ.WriteString(p.tok)
+			p.next()
+		}
+		if typ.Len() == 0 {
+			return nil, fmt.Errorf("expected type of variable $%s, got %q", name, p.tok)
+		}
+		types[name] = typ.String()
+
+		if p.tok == "=" {
+			p.next()
+			if _, err := p.value(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.next()
+	return types, p.err
+}
+
+// selectionSet parses `{ field ... }`
+func (p *queryParser) selectionSet() ([]*field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var fields []*field
+	for p.tok != "}" {
+		if p.err != nil {
+			return nil, p.err
+		}
+		if !p.isName() {
+			return nil, fmt.Errorf("expected field name, got %q", p.tok)
+		}
+		f := &field{alias: p.tok, name: p.tok}
+		p.next()
+
+		if p.tok == ":" {
+			p.next()
+			if !p.isName() {
+				return nil, fmt.Errorf("expected field name after alias %q, got %q", f.alias, p.tok)
+			}
+			f.name = p.tok
+			p.next()
+		}
+
+		if p.tok == "(" {
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			f.args = args
+		}
+
+		if p.tok == "{" {
+			selection, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			f.selection = selection
+		}
+
+		fields = append(fields, f)
+	}
+	p.next()
+	return fields, nil
+}
+
+// arguments parses `(name: value ...)`
+func (p *queryParser) arguments() (map[string]any, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]any)
+	for p.tok != ")" {
+		name, value, err := p.namedValue()
+		if err != nil {
+			return nil, err
+		}
+		args[name] = value
+	}
+	p.next()
+	return args, nil
+}
+
+// namedValue parses `name: value`
+func (p *queryParser) namedValue() (string, any, error) {
+	if !p.isName() {
+		return "", nil, fmt.Errorf("expected argument name, got %q", p.tok)
+	}
+	name := p.tok
+	p.next()
+	if err := p.expect(":"); err != nil {
+		return "", nil, err
+	}
+	value, err := p.value()
+	return name, value, err
+}
+
+// value parses a literal, a variable, a list or an object. Numbers are kept as
+// json.Number so that they compare like the strings used for BigInt values.
+func (p *queryParser) value() (any, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of query")
+
+	case tok == "[":
+		p.next()
+		list := []any{}
+		for p.tok != "]" {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+
+	case tok == "{":
+		p.next()
+		object := make(map[string]any)
+		for p.tok != "}" {
+			name, v, err := p.namedValue()
+			if err != nil {
+				return nil, err
+			}
+			object[name] = v
+		}
+		p.next()
+		return object, nil
+
+	case tok[0] == '$':
+		p.next()
+		return variable(tok[1:]), nil
+
+	case tok[0] == '"':
+		var s string
+		if err := json.Unmarshal([]byte(tok), &s); err != nil {
+			return nil, fmt.Errorf("invalid string %s: %w", tok, err)
+		}
+		p.next()
+		return s, nil
+
+	case tok[0] == '-' || unicode.IsDigit(rune(tok[0])):
+		p.next()
+		return json.Number(tok), nil
+
+	case tok == "true" || tok == "false":
+		p.next()
+		return tok == "true", nil
+
+	case tok == "null":
+		p.next()
+		return nil, nil
+
+	case p.isName():
+		p.next()
+		return enum(tok), nil
+	}
+	return nil, fmt.Errorf("unexpected %q", strings.TrimSpace(tok))
+}
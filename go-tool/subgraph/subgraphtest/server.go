@@ -0,0 +1,148 @@
+// Package subgraphtest provides an in-process stand-in for the DavinciDAO subgraph, so that
+// code built on subgraph.Client can be tested without a Graph endpoint.
+//
+// The server answers the GraphQL queries issued by subgraph.Client from an in-memory
+// Fixture: root fields for every entity (by id and as collections with first, skip,
+// where, orderBy and orderDirection), aliases, `_meta` and `block: {number: N}` pinning.
+// Like graph-node, it rejects variables whose declared type does not match the filtered field,
+// and queries pinned to a block past the indexed head or before Fixture.EarliestBlock.
+// Only immutable entities (weight change events and census roots) are versioned by block;
+// pinned queries return the latest state of the other entities.
+package subgraphtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph"
+)
+
+// Server is a fake subgraph GraphQL endpoint
+type Server struct {
+	URL string
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	fixture  *Fixture
+	store    *store
+	requests int
+	failures []int // status codes returned by the next requests
+}
+
+// NewServer starts a server serving the fixture. The fixture must not be modified
+// afterwards except through Update. The caller must Close the server.
+func NewServer(fixture *Fixture) *Server {
+	if fixture == nil {
+		fixture = &Fixture{}
+	}
+	s := &Server{
+		fixture: fixture,
+		store:   newStore(fixture),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns a subgraph client for the server. Retries have no delay by default.
+func (s *Server) Client(opts ...subgraph.Option) *subgraph.Client {
+	defaults := []subgraph.Option{
+		subgraph.WithHTTPClient(s.server.Client()),
+		subgraph.WithRetry(3, 0, 0),
+	}
+	return subgraph.NewClient(s.URL, append(defaults, opts...)...)
+}
+
+// Update modifies the fixture, e.g. to index new events or move the head
+func (s *Server) Update(fn func(fixture *Fixture)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.fixture)
+	s.store = newStore(s.fixture)
+}
+
+// FailNext makes the next n requests fail with the given HTTP status code
+func (s *Server) FailNext(n int, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, statusCode)
+	}
+}
+
+// Requests returns the number of requests received, including failed ones
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// graphQLRequest is the body of a GraphQL request
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+// graphQLError is an entry of the errors of a GraphQL response
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// handle serves a GraphQL request. Like graph-node, query errors are reported with
+// status 200 and an `errors` list.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mu.Unlock()
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	store := s.store
+	s.mu.Unlock()
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req graphQLRequest
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := make(map[string]any)
+	fields, err := parseQuery(req.Query, req.Variables)
+	if err == nil {
+		response["data"], err = store.execute(fields)
+	}
+	if err != nil {
+		response = map[string]any{"errors": []graphQLError{{Message: err.Error()}}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,61 @@
+package subgraphtest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vocdoni/davinci-onchain-census/go-tool/subgraph/subgraphtest"
+)
+
+func TestMetaBlock(t *testing.T) {
+	ctx := context.Background()
+	reorged := common.HexToHash("0x1234")
+	server := subgraphtest.NewServer(&subgraphtest.Fixture{
+		Head:          30,
+		EarliestBlock: 10,
+		BlockHashes:   map[uint64]common.Hash{20: reorged, 25: {}},
+	})
+	defer server.Close()
+	client := server.Client()
+
+	hashes, err := client.BlockHashes(ctx, []uint64{10, 20, 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]common.Hash{10: subgraphtest.BlockHash(10), 20: reorged, 30: subgraphtest.BlockHash(30)}
+	for number, hash := range want {
+		if hashes[number] != hash {
+			t.Fatalf("hash of block %d = %s, want %s", number, hashes[number], hash)
+		}
+	}
+
+	// A null hash is unknown, not a zero hash
+	hashes, err = client.BlockHashes(ctx, []uint64{25, 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hashes[25]; ok || hashes[30] != subgraphtest.BlockHash(30) {
+		t.Fatalf("hashes with block 25 unknown = %v", hashes)
+	}
+
+	// Blocks past the head or pruned from the history fail the request
+	for _, tc := range []struct {
+		number uint64
+		err    string
+	}{
+		{31, "has only indexed up to block number 30"},
+		{9, "only has data starting at block number 10"},
+	} {
+		if _, err := client.BlockHashes(ctx, []uint64{20, tc.number}); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("BlockHashes(%d) error = %v, want %q", tc.number, err, tc.err)
+		}
+	}
+
+	// Pinned entity queries fail the same way
+	if _, err := client.AtBlock(9).GetLatestCensusRoots(ctx, 1, nil); err == nil {
+		t.Fatal("query pinned to a pruned block succeeded")
+	}
+}